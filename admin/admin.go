@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+// DefaultDrainTimeout is how long a drain waits for in-flight handlers.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Counters is implemented by metrics that count events per subject, such as
+// *metrics.Expvar. Counters returns the counts per subject, keyed by what is
+// counted.
+type Counters interface {
+	Counters() map[string]map[string]int64
+}
+
+// ConsumerInfo describes a consumer, as served by Handler.
+type ConsumerInfo struct {
+	Name     string          `json:"name"`
+	State    string          `json:"state"`
+	Paused   bool            `json:"paused"`
+	InFlight []InFlightEvent `json:"in_flight"`
+}
+
+// InFlightEvent is an event being handled, as served by Handler.
+type InFlightEvent struct {
+	Subject string    `json:"subject"`
+	Started time.Time `json:"started"`
+	Age     string    `json:"age"`
+	Attempt uint64    `json:"attempt,omitempty"`
+}
+
+// Handler serves introspection and control of consumers over HTTP:
+//
+//	GET  /routes                 routes of Mux
+//	GET  /counters               counters per subject of Metrics
+//	GET  /consumers              consumers with their in-flight events
+//	GET  /consumers/{name}       a single consumer
+//	POST /consumers/{name}/pause
+//	POST /consumers/{name}/resume
+//	POST /consumers/{name}/drain shuts the consumer down gracefully
+//
+// Use http.StripPrefix to serve it under a prefix. It has no access control
+// of its own, so it should not be exposed publicly.
+type Handler struct {
+	// Mux whose routes are served, if set.
+	Mux *cone.HandlerMux
+
+	// Metrics whose counters are served, if set.
+	Metrics Counters
+
+	// DrainTimeout, if non-zero, replaces DefaultDrainTimeout.
+	DrainTimeout time.Duration
+
+	initOnce sync.Once
+	serveMux *http.ServeMux
+
+	mu        sync.Mutex
+	names     []string
+	consumers map[string]*cone.Consumer
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// Add makes a consumer available under name. It panics if name is empty or
+// already added.
+func (h *Handler) Add(name string, c *cone.Consumer) {
+	if name == "" {
+		panic("empty consumer name is not allowed")
+	}
+	if c == nil {
+		panic("nil consumer is not allowed")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.consumers[name]; ok {
+		panic("consumer " + name + " is already added")
+	}
+	if h.consumers == nil {
+		h.consumers = make(map[string]*cone.Consumer)
+	}
+	h.consumers[name] = c
+	h.names = append(h.names, name)
+	slices.Sort(h.names)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.initOnce.Do(func() {
+		h.serveMux = http.NewServeMux()
+		h.serveMux.HandleFunc("GET /routes", h.routes)
+		h.serveMux.HandleFunc("GET /counters", h.counters)
+		h.serveMux.HandleFunc("GET /consumers", h.listConsumers)
+		h.serveMux.HandleFunc("GET /consumers/{name}", h.getConsumer)
+		h.serveMux.HandleFunc("POST /consumers/{name}/pause", h.pause)
+		h.serveMux.HandleFunc("POST /consumers/{name}/resume", h.resume)
+		h.serveMux.HandleFunc("POST /consumers/{name}/drain", h.drain)
+	})
+	h.serveMux.ServeHTTP(w, r)
+}
+
+func (h *Handler) routes(w http.ResponseWriter, r *http.Request) {
+	if h.Mux == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Mux.Routes())
+}
+
+func (h *Handler) counters(w http.ResponseWriter, r *http.Request) {
+	if h.Metrics == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Metrics.Counters())
+}
+
+func (h *Handler) listConsumers(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	names := slices.Clone(h.names)
+	h.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]ConsumerInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, consumerInfo(name, h.consumer(name), now))
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (h *Handler) getConsumer(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c := h.consumer(name)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, consumerInfo(name, c, time.Now()))
+}
+
+func (h *Handler) pause(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c := h.consumer(name)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	c.Pause()
+	writeJSON(w, http.StatusOK, consumerInfo(name, c, time.Now()))
+}
+
+func (h *Handler) resume(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c := h.consumer(name)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	c.Resume()
+	writeJSON(w, http.StatusOK, consumerInfo(name, c, time.Now()))
+}
+
+// drain starts a graceful shutdown of the consumer, without waiting for it
+// to complete, as it can take longer than the request is allowed to.
+func (h *Handler) drain(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c := h.consumer(name)
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := c.State()
+	if state != cone.StateRunning && state != cone.StateRestarting {
+		http.Error(w, "consumer is "+state.String(), http.StatusConflict)
+		return
+	}
+
+	timeout := h.DrainTimeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_ = c.Shutdown(ctx)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) consumer(name string) *cone.Consumer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.consumers[name]
+}
+
+func consumerInfo(name string, c *cone.Consumer, now time.Time) ConsumerInfo {
+	info := ConsumerInfo{
+		Name:     name,
+		State:    c.State().String(),
+		Paused:   c.Paused(),
+		InFlight: []InFlightEvent{},
+	}
+	for _, e := range c.InFlight() {
+		info.InFlight = append(info.InFlight, InFlightEvent{
+			Subject: e.Subject,
+			Started: e.Started,
+			Age:     now.Sub(e.Started).Round(time.Millisecond).String(),
+			Attempt: e.Attempt,
+		})
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,132 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/admin"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/metrics"
+)
+
+func TestHandler(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	mux := cone.NewHandlerMux()
+	mux.HandleFunc("event.subject", func(r cone.Response, _ *cone.Event) {
+		<-block
+	})
+
+	m := metrics.NewExpvar("")
+	s := conetest.NewSource()
+	s.AddEvent(conetest.NewEvent("event.subject", nil))
+	c := cone.New(s, mux)
+	c.Metrics = m
+
+	h := admin.NewHandler()
+	h.Mux = mux
+	h.Metrics = m
+	h.Add("orders", c)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = c.ListenAndConsume()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	t.Run("Routes", func(t *testing.T) {
+		var routes []cone.Route
+		if code := serve(t, h, http.MethodGet, "/routes", &routes); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		if len(routes) != 1 || routes[0].Subject != "event.subject" {
+			t.Fatalf("Expected route event.subject but got %v", routes)
+		}
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		var counters map[string]map[string]any
+		if code := serve(t, h, http.MethodGet, "/counters", &counters); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		if counters["started"]["event.subject"] != float64(1) {
+			t.Fatalf("Expected 1 started event but got %v", counters["started"]["event.subject"])
+		}
+	})
+
+	t.Run("Consumers", func(t *testing.T) {
+		var consumers []admin.ConsumerInfo
+		if code := serve(t, h, http.MethodGet, "/consumers", &consumers); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		if len(consumers) != 1 || consumers[0].Name != "orders" {
+			t.Fatalf("Expected consumer orders but got %v", consumers)
+		}
+		if len(consumers[0].InFlight) != 1 || consumers[0].InFlight[0].Subject != "event.subject" {
+			t.Fatalf("Expected event.subject in flight but got %v", consumers[0].InFlight)
+		}
+	})
+
+	t.Run("Unknown consumer", func(t *testing.T) {
+		if code := serve(t, h, http.MethodGet, "/consumers/payments", nil); code != http.StatusNotFound {
+			t.Fatalf("Expected 404 but got %d", code)
+		}
+	})
+
+	t.Run("Pause and resume", func(t *testing.T) {
+		var info admin.ConsumerInfo
+		if code := serve(t, h, http.MethodPost, "/consumers/orders/pause", &info); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		if !info.Paused || !c.Paused() {
+			t.Fatal("Expected consumer to be paused")
+		}
+
+		if code := serve(t, h, http.MethodPost, "/consumers/orders/resume", &info); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		if info.Paused || c.Paused() {
+			t.Fatal("Expected consumer to be resumed")
+		}
+	})
+
+	t.Run("Pause requires POST", func(t *testing.T) {
+		if code := serve(t, h, http.MethodGet, "/consumers/orders/pause", nil); code != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected 405 but got %d", code)
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		if code := serve(t, h, http.MethodPost, "/consumers/orders/drain", nil); code != http.StatusAccepted {
+			t.Fatalf("Expected 202 but got %d", code)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if c.State() != cone.StateDraining {
+			t.Fatalf("Expected consumer to be draining but got %s", c.State())
+		}
+
+		if code := serve(t, h, http.MethodPost, "/consumers/orders/drain", nil); code != http.StatusConflict {
+			t.Fatalf("Expected 409 but got %d", code)
+		}
+	})
+}
+
+func serve(t *testing.T, h http.Handler, method, path string, v any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+	if v != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+	}
+	return rec.Code
+}
@@ -0,0 +1,255 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+var _ cone.Throttle = &Breaker{}
+
+const (
+	DefaultFailureRatio = 0.5
+	DefaultMinEvents    = 10
+	DefaultWindow       = 10 * time.Second
+	DefaultOpenTimeout  = 30 * time.Second
+)
+
+// probeInterval is how often a consumer throttled by a half-open breaker
+// checks whether the probe has finished.
+const probeInterval = 10 * time.Millisecond
+
+// State is the state of a Breaker.
+//
+// A breaker starts out Closed, letting events through. It trips, moving to
+// Open, when too many of them fail. After OpenTimeout it moves to HalfOpen
+// and lets a single event through as a probe. If the probe succeeds the
+// breaker closes again, otherwise it opens for another OpenTimeout.
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Breaker is a circuit breaker for events. Events are failures if they are
+// Nak'd, or if their handler panics. While the breaker is open, events are
+// Nak'd with a delay until it is half-open.
+//
+// Set the Breaker as the Throttle of the consumer to stop it from handing out
+// events while the breaker is open, and while the probe is in flight. A
+// PausableSource, such as the JetStream source, is also paused while the
+// breaker is open, provided OpenTimeout is at least the ThrottlePause of the
+// consumer, so it does not fetch events that would only wait past their ack
+// deadline. It is resumed to fetch the probe.
+type Breaker struct {
+	// FailureRatio is the ratio of failed events that trips the breaker. If
+	// zero, DefaultFailureRatio is used.
+	FailureRatio float64
+
+	// MinEvents is the number of events in a window before the breaker can
+	// trip. If zero, DefaultMinEvents is used.
+	MinEvents int
+
+	// Window is how long events are counted for before the counts start
+	// over. If zero, DefaultWindow is used.
+	Window time.Duration
+
+	// OpenTimeout is how long the breaker stays open before it lets a probe
+	// through. If zero, DefaultOpenTimeout is used.
+	OpenTimeout time.Duration
+
+	// OnStateChange, if set, is called every time the breaker changes
+	// state. It is called synchronously and must not block.
+	OnStateChange func(from, to State)
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	total       int
+	failures    int
+	openedAt    time.Time
+}
+
+func New() *Breaker {
+	return &Breaker{}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Middleware returns middleware passing events to next while the breaker is
+// closed. Wrap the HandlerMux with it, rather than adding it with Use, so
+// Naks made by the mux are counted too.
+func (b *Breaker) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		probe, delay, ok := b.allow()
+		if !ok {
+			_ = cone.NakWithDelay(r, delay)
+			return
+		}
+
+		recorder := cone.RecordOutcome(r)
+		returned := false
+		defer func() {
+			b.done(probe, recorder.Outcome() == cone.OutcomeNak || !returned)
+		}()
+
+		next.Serve(recorder, e)
+		returned = true
+	})
+}
+
+// Delay returns how long until the breaker lets a probe through while it is
+// open, and a short interval while the probe is in flight.
+func (b *Breaker) Delay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		return max(time.Until(b.openedAt.Add(b.openTimeout())), 0)
+	case StateHalfOpen:
+		return probeInterval
+	default:
+		return 0
+	}
+}
+
+// allow reports whether an event may be handled, and whether it is the
+// probe. Otherwise it returns how long to delay the event for.
+func (b *Breaker) allow() (probe bool, delay time.Duration, ok bool) {
+	var c change
+	defer func() { b.notify(c) }() // Runs after the unlock below
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		return false, 0, true
+	case StateOpen:
+		if remaining := time.Until(b.openedAt.Add(b.openTimeout())); remaining > 0 {
+			return false, remaining, false
+		}
+		c = b.setState(StateHalfOpen)
+		return true, 0, true
+	default: // The probe is in flight
+		return false, b.openTimeout(), false
+	}
+}
+
+// done records the result of an event.
+func (b *Breaker) done(probe, failed bool) {
+	var c change
+	defer func() { b.notify(c) }() // Runs after the unlock below
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if probe {
+		if failed {
+			c = b.open(now)
+		} else {
+			b.resetWindow(now)
+			c = b.setState(StateClosed)
+		}
+		return
+	}
+
+	if b.state != StateClosed {
+		return // Handled before the breaker tripped
+	}
+
+	if now.Sub(b.windowStart) > b.window() {
+		b.resetWindow(now)
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+
+	if b.total >= b.minEvents() && float64(b.failures)/float64(b.total) >= b.failureRatio() {
+		c = b.open(now)
+	}
+}
+
+func (b *Breaker) open(now time.Time) change {
+	b.openedAt = now
+	return b.setState(StateOpen)
+}
+
+func (b *Breaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.total = 0
+	b.failures = 0
+}
+
+// change is a state change to report to OnStateChange.
+type change struct {
+	from, to State
+}
+
+// setState moves the breaker to state, returning the change to pass to
+// notify once b.mu is released. b.mu must be held.
+func (b *Breaker) setState(state State) change {
+	prev := b.state
+	b.state = state
+	return change{from: prev, to: state}
+}
+
+// notify calls OnStateChange if the state changed. b.mu must not be held, so
+// OnStateChange can use the breaker.
+func (b *Breaker) notify(c change) {
+	if b.OnStateChange != nil && c.from != c.to {
+		b.OnStateChange(c.from, c.to)
+	}
+}
+
+func (b *Breaker) failureRatio() float64 {
+	if b.FailureRatio == 0 {
+		return DefaultFailureRatio
+	}
+	return b.FailureRatio
+}
+
+func (b *Breaker) minEvents() int {
+	if b.MinEvents == 0 {
+		return DefaultMinEvents
+	}
+	return b.MinEvents
+}
+
+func (b *Breaker) window() time.Duration {
+	if b.Window == 0 {
+		return DefaultWindow
+	}
+	return b.Window
+}
+
+func (b *Breaker) openTimeout() time.Duration {
+	if b.OpenTimeout == 0 {
+		return DefaultOpenTimeout
+	}
+	return b.OpenTimeout
+}
@@ -0,0 +1,205 @@
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/breaker"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestBreaker(t *testing.T) {
+	var fail bool
+	handler := cone.HandlerFunc(func(r cone.Response, _ *cone.Event) {
+		if fail {
+			_ = r.Nak()
+			return
+		}
+		_ = r.Ack()
+	})
+
+	serve := func(h cone.Handler) *conetest.ResponseRecorder {
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.subject", nil))
+		return r
+	}
+
+	newBreaker := func() *breaker.Breaker {
+		b := breaker.New()
+		b.MinEvents = 4
+		b.OpenTimeout = 20 * time.Millisecond
+		return b
+	}
+
+	t.Run("Should trip on failure ratio", func(t *testing.T) {
+		fail = false
+		b := newBreaker()
+		h := b.Middleware(handler)
+
+		serve(h)
+		serve(h)
+		fail = true
+		serve(h)
+		if b.State() != breaker.StateClosed {
+			t.Fatalf("Expected %s before MinEvents but got %s", breaker.StateClosed, b.State())
+		}
+		serve(h)
+		if b.State() != breaker.StateOpen {
+			t.Fatalf("Expected %s but got %s", breaker.StateOpen, b.State())
+		}
+	})
+
+	t.Run("Open breaker should nak with delay", func(t *testing.T) {
+		fail = true
+		b := newBreaker()
+		h := b.Middleware(handler)
+		for i := 0; i < 4; i++ {
+			serve(h)
+		}
+
+		fail = false
+		r := serve(h)
+		if r.Result() != conetest.Nak || r.Delay() <= 0 || r.Delay() > 20*time.Millisecond {
+			t.Fatalf("Expected %s with delay of at most 20ms but got %s with %s", conetest.Nak, r.Result(), r.Delay())
+		}
+		if d := b.Delay(); d <= 0 {
+			t.Fatalf("Expected consumer to be throttled but got %s", d)
+		}
+	})
+
+	t.Run("Successful probe should close the breaker", func(t *testing.T) {
+		fail = true
+		b := newBreaker()
+		var states []breaker.State
+		b.OnStateChange = func(_, to breaker.State) {
+			states = append(states, to)
+		}
+		h := b.Middleware(handler)
+		for i := 0; i < 4; i++ {
+			serve(h)
+		}
+
+		time.Sleep(25 * time.Millisecond)
+		if d := b.Delay(); d != 0 {
+			t.Fatalf("Expected the probe to be let through but got delay %s", d)
+		}
+
+		fail = false
+		if r := serve(h); r.Result() != conetest.Ack {
+			t.Fatalf("Expected probe to be %s but got %s", conetest.Ack, r.Result())
+		}
+		if b.State() != breaker.StateClosed {
+			t.Fatalf("Expected %s but got %s", breaker.StateClosed, b.State())
+		}
+
+		expected := []breaker.State{breaker.StateOpen, breaker.StateHalfOpen, breaker.StateClosed}
+		if len(states) != len(expected) {
+			t.Fatalf("Expected states %v but got %v", expected, states)
+		}
+		for i := range expected {
+			if states[i] != expected[i] {
+				t.Fatalf("Expected states %v but got %v", expected, states)
+			}
+		}
+	})
+
+	t.Run("OnStateChange should be able to use the breaker", func(t *testing.T) {
+		fail = true
+		b := newBreaker()
+		var states []breaker.State
+		b.OnStateChange = func(_, _ breaker.State) {
+			states = append(states, b.State())
+		}
+		h := b.Middleware(handler)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 4; i++ {
+				serve(h)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected OnStateChange not to deadlock")
+		}
+		if len(states) != 1 || states[0] != breaker.StateOpen {
+			t.Fatalf("Expected states [%s] but got %v", breaker.StateOpen, states)
+		}
+	})
+
+	t.Run("Failed probe should open the breaker", func(t *testing.T) {
+		fail = true
+		b := newBreaker()
+		h := b.Middleware(handler)
+		for i := 0; i < 4; i++ {
+			serve(h)
+		}
+
+		time.Sleep(25 * time.Millisecond)
+		serve(h)
+		if b.State() != breaker.StateOpen {
+			t.Fatalf("Expected %s but got %s", breaker.StateOpen, b.State())
+		}
+	})
+
+	t.Run("Only one probe should be let through", func(t *testing.T) {
+		fail = true
+		b := newBreaker()
+		for i := 0; i < 4; i++ {
+			serve(b.Middleware(handler))
+		}
+		time.Sleep(25 * time.Millisecond)
+
+		probing := make(chan struct{})
+		release := make(chan struct{})
+		h := b.Middleware(cone.HandlerFunc(func(r cone.Response, _ *cone.Event) {
+			close(probing)
+			<-release
+			_ = r.Ack()
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			serve(h)
+		}()
+		<-probing
+
+		if b.State() != breaker.StateHalfOpen {
+			t.Fatalf("Expected %s but got %s", breaker.StateHalfOpen, b.State())
+		}
+		if r := serve(h); r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s while probing but got %s", conetest.Nak, r.Result())
+		}
+		if d := b.Delay(); d <= 0 {
+			t.Fatalf("Expected consumer to be throttled while probing but got %s", d)
+		}
+
+		close(release)
+		<-done
+		if b.State() != breaker.StateClosed {
+			t.Fatalf("Expected %s but got %s", breaker.StateClosed, b.State())
+		}
+	})
+
+	t.Run("Panics should count as failures", func(t *testing.T) {
+		b := newBreaker()
+		b.MinEvents = 1
+		h := b.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+			panic("handler failed")
+		}))
+
+		func() {
+			defer func() { _ = recover() }()
+			serve(h)
+		}()
+
+		if b.State() != breaker.StateOpen {
+			t.Fatalf("Expected %s but got %s", breaker.StateOpen, b.State())
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/zapling/cone"
+)
+
+// Encodings of event bodies, as given in the Content-Encoding header.
+const (
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+	Snappy   = "snappy"
+	Identity = "identity"
+)
+
+const (
+	// Header holding the encoding of the event body.
+	Header = "Content-Encoding"
+
+	// DefaultMaxSize is the default limit on the size of decompressed bodies.
+	DefaultMaxSize = 16 << 20
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrTooLarge            = errors.New("decompressed body too large")
+)
+
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+})
+
+// Compressor compresses the bodies of published events and sets their
+// Content-Encoding header.
+type Compressor struct {
+	// Encoding to compress with, one of Gzip, Zstd and Snappy.
+	Encoding string
+
+	// MinSize is the size below which bodies are published uncompressed, as
+	// compressing them saves little.
+	MinSize int
+}
+
+// Publisher returns a publisher compressing events before passing them to
+// next. It panics if the encoding is not supported.
+func (c *Compressor) Publisher(next cone.Publisher) cone.Publisher {
+	if !supported(c.Encoding) || c.Encoding == Identity {
+		panic(fmt.Sprintf("%s %q", ErrUnsupportedEncoding, c.Encoding))
+	}
+
+	return cone.PublisherFunc(func(ctx context.Context, e *cone.Event) error {
+		if len(e.Body) < c.MinSize || e.Header.Get(Header) != "" {
+			return next.Publish(ctx, e)
+		}
+
+		body, err := Encode(c.Encoding, e.Body)
+		if err != nil {
+			return err
+		}
+
+		compressed := e.WithContext(e.Context())
+		compressed.Body = body
+		compressed.Header = maps.Clone(e.Header)
+		if compressed.Header == nil {
+			compressed.Header = make(cone.Header)
+		}
+		compressed.Header.Set(Header, c.Encoding)
+
+		return next.Publish(ctx, compressed)
+	})
+}
+
+// Decompressor decompresses event bodies according to their
+// Content-Encoding header. Events without the header are passed on as is.
+type Decompressor struct {
+	// MaxSize limits the size of decompressed bodies, to guard against
+	// decompression bombs. Defaults to DefaultMaxSize.
+	MaxSize int
+
+	// OnError responds to events that could not be decompressed. If nil,
+	// they are terminated with cone.Term, as redelivering them would not
+	// help.
+	OnError func(r cone.Response, e *cone.Event, err error)
+}
+
+// Middleware decompresses events before passing them to next. The event
+// passed on has the decompressed body, and no Content-Encoding header.
+func (d *Decompressor) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		encoding := e.Header.Get(Header)
+		if encoding == "" {
+			next.Serve(r, e)
+			return
+		}
+
+		body, err := Decode(encoding, e.Body, d.maxSize())
+		if err != nil {
+			if d.OnError != nil {
+				d.OnError(r, e, err)
+				return
+			}
+			_ = cone.Term(r)
+			return
+		}
+
+		decompressed := e.WithContext(e.Context())
+		decompressed.Body = body
+		decompressed.Header = maps.Clone(e.Header)
+		delete(decompressed.Header, Header)
+
+		next.Serve(r, decompressed)
+	})
+}
+
+func (d *Decompressor) maxSize() int {
+	if d.MaxSize <= 0 {
+		return DefaultMaxSize
+	}
+	return d.MaxSize
+}
+
+// Encode compresses body with encoding.
+func Encode(encoding string, body []byte) ([]byte, error) {
+	switch normalize(encoding) {
+	case Gzip:
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(body); err != nil {
+			return nil, fmt.Errorf("failed to compress: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress: %w", err)
+		}
+		return b.Bytes(), nil
+	case Zstd:
+		return zstdEncoder().EncodeAll(body, nil), nil
+	case Snappy:
+		return s2.EncodeSnappy(nil, body), nil
+	case Identity:
+		return body, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Decode decompresses body encoded with encoding. It fails with ErrTooLarge
+// if the decompressed body would exceed maxSize bytes.
+func Decode(encoding string, body []byte, maxSize int) ([]byte, error) {
+	var decoded []byte
+	var err error
+
+	switch normalize(encoding) {
+	case Gzip:
+		decoded, err = decodeGzip(body, maxSize)
+	case Zstd:
+		decoded, err = decodeZstd(body, maxSize)
+	case Snappy:
+		decoded, err = decodeSnappy(body, maxSize)
+	case Identity:
+		decoded = body
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) > maxSize {
+		return nil, fmt.Errorf("%w, limit is %d bytes", ErrTooLarge, maxSize)
+	}
+	return decoded, nil
+}
+
+func decodeGzip(body []byte, maxSize int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip: %w", err)
+	}
+	defer r.Close()
+
+	// Read one byte past the limit to tell a body of exactly maxSize bytes
+	// from a larger one.
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip: %w", err)
+	}
+	return decoded, nil
+}
+
+func decodeZstd(body []byte, maxSize int) ([]byte, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress zstd: %w", err)
+	}
+	defer dec.Close()
+
+	decoded, err := dec.DecodeAll(body, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, fmt.Errorf("%w, limit is %d bytes", ErrTooLarge, maxSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress zstd: %w", err)
+	}
+	return decoded, nil
+}
+
+func decodeSnappy(body []byte, maxSize int) ([]byte, error) {
+	size, err := s2.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress snappy: %w", err)
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("%w, limit is %d bytes", ErrTooLarge, maxSize)
+	}
+
+	decoded, err := s2.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress snappy: %w", err)
+	}
+	return decoded, nil
+}
+
+func supported(encoding string) bool {
+	switch normalize(encoding) {
+	case Gzip, Zstd, Snappy, Identity:
+		return true
+	}
+	return false
+}
+
+func normalize(encoding string) string {
+	return strings.ToLower(strings.TrimSpace(encoding))
+}
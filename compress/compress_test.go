@@ -0,0 +1,187 @@
+package compress_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/compress"
+	"github.com/zapling/cone/conetest"
+)
+
+var encodings = []string{compress.Gzip, compress.Zstd, compress.Snappy}
+
+func TestEncodeDecode(t *testing.T) {
+	body := bytes.Repeat([]byte("a large document "), 1000)
+
+	for _, encoding := range encodings {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := compress.Encode(encoding, body)
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if len(encoded) >= len(body) {
+				t.Fatalf("Expected body to be compressed but got %d bytes from %d", len(encoded), len(body))
+			}
+
+			decoded, err := compress.Decode(encoding, encoded, len(body))
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if !bytes.Equal(decoded, body) {
+				t.Fatalf("Expected decoded body to match the original")
+			}
+		})
+	}
+
+	t.Run("Unsupported encoding", func(t *testing.T) {
+		if _, err := compress.Encode("br", body); !errors.Is(err, compress.ErrUnsupportedEncoding) {
+			t.Fatalf("Expected ErrUnsupportedEncoding but got %v", err)
+		}
+		if _, err := compress.Decode("br", body, len(body)); !errors.Is(err, compress.ErrUnsupportedEncoding) {
+			t.Fatalf("Expected ErrUnsupportedEncoding but got %v", err)
+		}
+	})
+}
+
+func TestDecodeMaxSize(t *testing.T) {
+	// A bomb: a small body that decompresses to 64 MiB
+	bomb := make([]byte, 64<<20)
+
+	for _, encoding := range encodings {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := compress.Encode(encoding, bomb)
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+
+			_, err = compress.Decode(encoding, encoded, 1<<20)
+			if !errors.Is(err, compress.ErrTooLarge) {
+				t.Fatalf("Expected ErrTooLarge but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	t.Run("Compresses large bodies", func(t *testing.T) {
+		p := conetest.NewPublisher()
+		publisher := (&compress.Compressor{Encoding: compress.Zstd, MinSize: 10}).Publisher(p)
+
+		e := conetest.NewEvent("documents", bytes.Repeat([]byte("x"), 100))
+		if err := publisher.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		published := p.Events()[0]
+		if published.Header.Get(compress.Header) != compress.Zstd {
+			t.Fatalf("Expected Content-Encoding zstd but got %q", published.Header.Get(compress.Header))
+		}
+		if len(published.Body) >= 100 {
+			t.Fatalf("Expected compressed body but got %d bytes", len(published.Body))
+		}
+		if e.Header.Get(compress.Header) != "" || len(e.Body) != 100 {
+			t.Fatalf("Expected original event to be unchanged")
+		}
+	})
+
+	t.Run("Leaves small bodies", func(t *testing.T) {
+		p := conetest.NewPublisher()
+		publisher := (&compress.Compressor{Encoding: compress.Gzip, MinSize: 10}).Publisher(p)
+
+		if err := publisher.Publish(context.Background(), conetest.NewEvent("documents", []byte("small"))); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if published := p.Events()[0]; published.Header.Get(compress.Header) != "" {
+			t.Fatalf("Expected small body to be left uncompressed")
+		}
+	})
+
+	t.Run("Unsupported encoding should panic", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatalf("Expected panic, encoding is not supported")
+			}
+		}()
+
+		(&compress.Compressor{Encoding: "br"}).Publisher(conetest.NewPublisher())
+	})
+}
+
+func TestDecompressor(t *testing.T) {
+	body := bytes.Repeat([]byte("a large document "), 100)
+
+	for _, encoding := range encodings {
+		t.Run("Round trip "+encoding, func(t *testing.T) {
+			p := conetest.NewPublisher()
+			publisher := (&compress.Compressor{Encoding: encoding}).Publisher(p)
+			if err := publisher.Publish(context.Background(), conetest.NewEvent("documents", body)); err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+
+			var got *cone.Event
+			handler := (&compress.Decompressor{}).Middleware(cone.HandlerFunc(func(_ cone.Response, e *cone.Event) {
+				got = e
+			}))
+			handler.Serve(conetest.NewRecorder(), p.Events()[0])
+
+			if got == nil || !bytes.Equal(got.Body, body) {
+				t.Fatalf("Expected handler to get decompressed body")
+			}
+			if got.Header.Get(compress.Header) != "" {
+				t.Fatalf("Expected Content-Encoding to be removed")
+			}
+		})
+	}
+
+	t.Run("Uncompressed events pass through", func(t *testing.T) {
+		called := false
+		handler := (&compress.Decompressor{}).Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+			called = true
+		}))
+
+		handler.Serve(conetest.NewRecorder(), conetest.NewEvent("documents", body))
+		if !called {
+			t.Fatalf("Expected handler to be called")
+		}
+	})
+
+	t.Run("Too large events are terminated", func(t *testing.T) {
+		encoded, _ := compress.Encode(compress.Gzip, body)
+		e := conetest.NewEvent("documents", encoded)
+		e.Header.Set(compress.Header, compress.Gzip)
+
+		called := false
+		handler := (&compress.Decompressor{MaxSize: 10}).Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+			called = true
+		}))
+
+		r := conetest.NewRecorder()
+		handler.Serve(r, e)
+		if called {
+			t.Fatalf("Expected handler not to be called")
+		}
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected Term but got %s", r.Result())
+		}
+	})
+
+	t.Run("OnError", func(t *testing.T) {
+		e := conetest.NewEvent("documents", []byte("not gzip"))
+		e.Header.Set(compress.Header, compress.Gzip)
+
+		var handlerErr error
+		d := &compress.Decompressor{OnError: func(r cone.Response, _ *cone.Event, err error) {
+			handlerErr = err
+			_ = r.Nak()
+		}}
+
+		r := conetest.NewRecorder()
+		d.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {})).Serve(r, e)
+		if handlerErr == nil || r.Result() != conetest.Nak {
+			t.Fatalf("Expected OnError to Nak but got %s, %v", r.Result(), handlerErr)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package conetest
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/zapling/cone"
+)
+
+var _ cone.Publisher = &Publisher{}
+
+func NewPublisher() *Publisher {
+	return &Publisher{}
+}
+
+// Publisher records the events published to it.
+type Publisher struct {
+	mu     sync.Mutex
+	events []*cone.Event
+	err    error
+}
+
+func (p *Publisher) Publish(_ context.Context, e *cone.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, e)
+	return nil
+}
+
+// SetError makes later calls to Publish fail with err.
+func (p *Publisher) SetError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Events returns the events published so far.
+func (p *Publisher) Events() []*cone.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.events)
+}
@@ -1,12 +1,21 @@
 package conetest
 
-import "github.com/zapling/cone"
+import (
+	"time"
 
-var _ cone.Response = &ResponseRecorder{}
+	"github.com/zapling/cone"
+)
+
+var (
+	_ cone.TermResponse  = &ResponseRecorder{}
+	_ cone.DelayResponse = &ResponseRecorder{}
+	_ cone.ResponseState = &ResponseRecorder{}
+)
 
 const (
-	Ack = "ack"
-	Nak = "nak"
+	Ack  = "ack"
+	Nak  = "nak"
+	Term = "term"
 )
 
 func NewRecorder() *ResponseRecorder {
@@ -14,23 +23,61 @@ func NewRecorder() *ResponseRecorder {
 }
 
 type ResponseRecorder struct {
-	response string
+	response  string
+	responses int
+	delay     time.Duration
 }
 
+// Result returns the first response given.
 func (r *ResponseRecorder) Result() string {
 	return r.response
 }
 
+// NumResponses returns how many times a response was given, including the
+// ones ignored after the first.
+func (r *ResponseRecorder) NumResponses() int {
+	return r.responses
+}
+
+func (r *ResponseRecorder) Responded() bool {
+	return r.response != ""
+}
+
 func (r *ResponseRecorder) Ack() error {
+	r.responses++
 	if r.response == "" {
-		r.response = "ack"
+		r.response = Ack
 	}
 	return nil
 }
 
 func (r *ResponseRecorder) Nak() error {
+	r.responses++
+	if r.response == "" {
+		r.response = Nak
+	}
+	return nil
+}
+
+// Delay returns the delay given with NakWithDelay, if it was the first
+// response.
+func (r *ResponseRecorder) Delay() time.Duration {
+	return r.delay
+}
+
+func (r *ResponseRecorder) NakWithDelay(delay time.Duration) error {
+	r.responses++
+	if r.response == "" {
+		r.response = Nak
+		r.delay = delay
+	}
+	return nil
+}
+
+func (r *ResponseRecorder) Term() error {
+	r.responses++
 	if r.response == "" {
-		r.response = "nak"
+		r.response = Term
 	}
 	return nil
 }
@@ -3,15 +3,22 @@ package conetest
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/zapling/cone"
 )
 
-var _ cone.Source = &Source{}
+var (
+	_ cone.Source         = &Source{}
+	_ cone.PausableSource = &Source{}
+	_ cone.TermResponse   = &sourceEvent{}
+	_ cone.ResponseState  = &sourceEvent{}
+)
 
 func NewSource() *Source {
 	return &Source{
 		eventsMap: make(map[int]*sourceEvent),
+		notify:    make(chan struct{}, 1),
 	}
 }
 
@@ -19,24 +26,81 @@ type Source struct {
 	mu      sync.Mutex
 	counter int
 
-	events    []*sourceEvent
-	ackEvents []*sourceEvent
-	nakEvents []*sourceEvent
+	events     []*sourceEvent
+	ackEvents  []*sourceEvent
+	nakEvents  []*sourceEvent
+	termEvents []*sourceEvent
 
 	eventsMap map[int]*sourceEvent
+
+	errs      []error
+	numStarts int
+	isRunning bool
+	isPaused  bool
+
+	notify chan struct{}
 }
 
 func (s *Source) Start() error {
-	return nil // We have nothing to do here
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.numStarts++
+	s.isRunning = true
+	s.isPaused = false
+	return nil
 }
 
 func (s *Source) Stop(ctx context.Context) error {
-	return nil // We have nothing to do here
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isRunning = false
+	return nil
 }
 
+// Next returns the next queued error or unprocessed event. Like a real
+// source it waits a little for one to be added before returning nothing.
 func (s *Source) Next() (cone.Response, *cone.Event, error) {
+	response, event, err := s.next()
+	if event != nil || err != nil {
+		return response, event, err
+	}
+
+	select {
+	case <-s.notify:
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	return s.next()
+}
+
+// Pause makes Next return no events until Resume is called.
+func (s *Source) Pause() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.isPaused = true
+	return nil
+}
+
+func (s *Source) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isPaused = false
+	return nil
+}
+
+func (s *Source) next() (cone.Response, *cone.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isPaused {
+		return nil, nil, nil
+	}
+
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, nil, err
+	}
 
 	for i := 0; i < len(s.events); i++ {
 		if s.events[i].isProcessing {
@@ -60,6 +124,45 @@ func (s *Source) AddEvent(e *cone.Event) {
 	s.eventsMap[event.id] = event
 
 	s.counter++
+	s.poke()
+}
+
+// AddError makes a future call to Next return err. Errors are returned in the
+// order they were added, before any queued events.
+func (s *Source) AddError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+	s.poke()
+}
+
+// poke wakes up a Next call waiting for events.
+func (s *Source) poke() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// IsRunning reports whether the source has been started and not stopped.
+func (s *Source) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isRunning
+}
+
+// IsPaused reports whether the source is paused.
+func (s *Source) IsPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isPaused
+}
+
+// NumStarts returns how many times the source has been started.
+func (s *Source) NumStarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.numStarts
 }
 
 func (s *Source) NumAckd() int {
@@ -71,7 +174,13 @@ func (s *Source) NumAckd() int {
 func (s *Source) NumNakd() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return len(s.ackEvents)
+	return len(s.nakEvents)
+}
+
+func (s *Source) NumTermd() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.termEvents)
 }
 
 func (s *Source) ackEvent(id int) error {
@@ -96,6 +205,16 @@ func (s *Source) nakEvent(id int) error {
 	return nil
 }
 
+func (s *Source) termEvent(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeEventFromQueue(id)
+	s.termEvents = append(s.termEvents, s.eventsMap[id])
+
+	return nil
+}
+
 func (s *Source) removeEventFromQueue(id int) {
 	for i := 0; i < len(s.events); i++ {
 		if s.events[i].id == id {
@@ -129,3 +248,15 @@ func (e *sourceEvent) Nak() error {
 	e.hasResponded = true
 	return e.source.nakEvent(e.id)
 }
+
+func (e *sourceEvent) Term() error {
+	if e.hasResponded {
+		return nil
+	}
+	e.hasResponded = true
+	return e.source.termEvent(e.id)
+}
+
+func (e *sourceEvent) Responded() bool {
+	return e.hasResponded
+}
@@ -4,36 +4,171 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
 	ErrConsumerStopped = errors.New("consumer stopped")
+
+	errNotRunning = errors.New("consumer is not running")
+)
+
+const defaultThrottlePause = time.Second
+
+// State describes what a Consumer is currently doing.
+//
+// A consumer starts out Idle and moves to Running when ListenAndConsume is
+// called. Running and Restarting alternate while the source is restarted
+// after transient errors. Shutdown moves it to Draining until in-flight
+// handlers are done, and from there to Stopped. Close, or a fatal source
+// error, moves it straight to Stopped. A stopped consumer can be started
+// again.
+type State int32
+
+const (
+	StateIdle State = iota
+	StateRunning
+	StateRestarting
+	StateDraining
+	StateStopped
 )
 
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRunning:
+		return "running"
+	case StateRestarting:
+		return "restarting"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+}
+
 func New(source Source, handler Handler) *Consumer {
 	return &Consumer{source: source, handler: handler}
 }
 
 type Consumer struct {
+	// Restart enables restarting the source with exponential backoff when it
+	// fails with a transient error. If nil, ListenAndConsume returns on the
+	// first source error.
+	Restart *RestartPolicy
+
+	// OnStateChange, if set, is called every time the consumer changes
+	// state. It is called synchronously and must not block.
+	OnStateChange func(from, to State)
+
+	// BaseContext optionally specifies the base context for events served
+	// by a call to ListenAndConsume. It is cancelled once the consumer has
+	// stopped and its in-flight handlers are done, or right away if they do
+	// not finish within the grace period given to Shutdown. If nil, the base
+	// context is context.Background().
+	BaseContext func() context.Context
+
+	// EventContext optionally modifies the context used for an event. The
+	// provided ctx is derived from the base context. The context set on the
+	// event by the source is replaced.
+	EventContext func(ctx context.Context, e *Event) context.Context
+
+	// HandlerTimeout, if non-zero, sets a deadline on the context of every
+	// event. Use TimeoutHandler for timeouts on specific subjects.
+	HandlerTimeout time.Duration
+
+	// Throttle, if set, is asked how long to wait before every event is
+	// fetched from the source.
+	Throttle Throttle
+
+	// ThrottlePause is the shortest Throttle delay for which a
+	// PausableSource is paused, so it does not keep fetching events from the
+	// server while they can not be handed out. The source is resumed once
+	// the Throttle has no delay. Defaults to 1s.
+	ThrottlePause time.Duration
+
+	// Metrics, if set, is told about every event served. Set it on the
+	// HandlerMux as well to count events with unknown subjects.
+	Metrics Metrics
+
 	source  Source
 	handler Handler
 
 	activeHandles sync.WaitGroup
+	inFlight      inFlightEvents
+	lastEvent     atomic.Int64 // unix nanoseconds of the last event delivered
 
-	isRunning  atomic.Bool
-	inShutdown atomic.Bool
+	mu            sync.Mutex
+	state         State
+	sourceRunning bool          // whether the source has been started and not stopped
+	quit          chan struct{} // closed to make the consume loop return
+	quitClosed    bool
+	loopDone      chan struct{} // closed when the consume loop has returned
+	done          chan struct{} // closed when the consumer is stopped
+	cancelEvents  context.CancelFunc
+	started       time.Time
+	resumed       chan struct{} // closed on Resume, nil unless paused
+	resumedAt     time.Time
 }
 
 func (c *Consumer) Serve(r Response, e *Event) {
 	c.handler.Serve(r, e)
 }
 
-func (c *Consumer) ListenAndConsume() error {
-	if c.isRunning.Load() {
-		return fmt.Errorf("is already running")
+// State returns the current state of the consumer.
+func (c *Consumer) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Done returns a channel that is closed when the consumer stops. A consumer
+// that is started again gets a new channel.
+func (c *Consumer) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done == nil {
+		c.done = make(chan struct{})
 	}
+	return c.done
+}
+
+// transition moves the consumer to state to if it currently is in one of the
+// from states, reporting the previous state and whether it moved.
+func (c *Consumer) transition(to State, from ...State) (State, bool) {
+	c.mu.Lock()
+	prev := c.state
+	if !slices.Contains(from, prev) {
+		c.mu.Unlock()
+		return prev, false
+	}
+	c.state = to
+	if to == StateStopped {
+		close(c.done)
+	}
+	c.mu.Unlock()
+
+	if c.OnStateChange != nil {
+		c.OnStateChange(prev, to)
+	}
+	return prev, true
+}
+
+func (c *Consumer) ListenAndConsume() error {
+	return c.listenAndConsume(func(bool) {})
+}
+
+// listenAndConsume is ListenAndConsume, calling started with true once the
+// consumer is running, or with false if it failed to start. started may be
+// called more than once, the first call tells which.
+func (c *Consumer) listenAndConsume(started func(running bool)) error {
+	defer started(false)
 
 	if c.source == nil {
 		return fmt.Errorf("source is nil")
@@ -43,16 +178,138 @@ func (c *Consumer) ListenAndConsume() error {
 		return fmt.Errorf("handler is nil")
 	}
 
-	c.isRunning.Swap(true)
-	defer c.isRunning.Swap(false)
+	baseCtx := context.Background()
+	if c.BaseContext != nil {
+		baseCtx = c.BaseContext()
+		if baseCtx == nil {
+			panic("BaseContext returned a nil context")
+		}
+	}
+	eventsCtx, cancelEvents := context.WithCancel(baseCtx)
+
+	c.mu.Lock()
+	prev := c.state
+	if prev != StateIdle && prev != StateStopped {
+		c.mu.Unlock()
+		cancelEvents()
+		return fmt.Errorf("is already running")
+	}
+	if c.done == nil || prev == StateStopped {
+		c.done = make(chan struct{})
+	}
+	c.quit = make(chan struct{})
+	c.quitClosed = false
+	c.loopDone = make(chan struct{})
+	quit, loopDone := c.quit, c.loopDone
+	c.cancelEvents = cancelEvents
+	c.state = StateRunning
+	c.started = time.Now()
+	c.mu.Unlock()
+	c.lastEvent.Store(0)
+
+	if c.OnStateChange != nil {
+		c.OnStateChange(prev, StateRunning)
+	}
+	started(true)
+
+	err := c.run(eventsCtx, quit)
+	close(loopDone)
+
+	if !errors.Is(err, ErrConsumerStopped) {
+		// The source failed for good, there is nothing left to drain from
+		_ = c.stopSource(nil)
+		c.transition(StateStopped, StateRunning, StateRestarting)
+
+		go func() {
+			c.activeHandles.Wait()
+			cancelEvents()
+		}()
+	}
+
+	return err
+}
+
+// run starts the source and serves its events, restarting it according to
+// the restart policy, until the source fails for good or quit is closed.
+func (c *Consumer) run(ctx context.Context, quit chan struct{}) error {
+	var attempt int
+	for {
+		err := c.source.Start()
+		if err != nil {
+			err = fmt.Errorf("failed to start source: %w", err)
+		} else {
+			c.mu.Lock()
+			c.sourceRunning = true
+			c.mu.Unlock()
+			err = c.consume(ctx, quit, &attempt)
+		}
+
+		if errors.Is(err, ErrConsumerStopped) || !c.canRestart(err, attempt) {
+			return err
+		}
+
+		if _, ok := c.transition(StateRestarting, StateRunning); !ok {
+			return ErrConsumerStopped
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Restart.stopTimeout())
+		_ = c.stopSource(ctx)
+		cancel()
 
-	if err := c.source.Start(); err != nil {
-		return fmt.Errorf("failed to start source: %w", err)
+		if !sleep(quit, c.Restart.backoff(attempt)) {
+			return ErrConsumerStopped
+		}
+		attempt++
+
+		if _, ok := c.transition(StateRunning, StateRestarting); !ok {
+			return ErrConsumerStopped
+		}
 	}
+}
 
+// consume serves events from the source until it fails or quit is closed.
+// Events get a context derived from ctx. attempt is reset once the source
+// delivers an event.
+func (c *Consumer) consume(ctx context.Context, quit chan struct{}, attempt *int) error {
+	var paused bool // whether the source has been paused by this loop
 	for {
-		if c.inShutdown.Load() {
+		select {
+		case <-quit:
 			return ErrConsumerStopped
+		default:
+		}
+
+		c.mu.Lock()
+		resumed := c.resumed
+		c.mu.Unlock()
+		if resumed != nil {
+			if err := c.pauseSource(&paused); err != nil {
+				return err
+			}
+			select {
+			case <-quit:
+				return ErrConsumerStopped
+			case <-resumed:
+			}
+			continue
+		}
+
+		if c.Throttle != nil {
+			if d := c.Throttle.Delay(); d > 0 {
+				if d >= c.throttlePause() {
+					if err := c.pauseSource(&paused); err != nil {
+						return err
+					}
+				}
+				if !sleep(quit, d) {
+					return ErrConsumerStopped
+				}
+				continue
+			}
+		}
+
+		if err := c.resumeSource(&paused); err != nil {
+			return err
 		}
 
 		response, event, err := c.source.Next()
@@ -64,45 +321,345 @@ func (c *Consumer) ListenAndConsume() error {
 			continue
 		}
 
+		select {
+		case <-quit:
+			// Shutdown started while waiting for the event, hand it back
+			_ = response.Nak()
+			return ErrConsumerStopped
+		default:
+		}
+
+		*attempt = 0
+		c.lastEvent.Store(time.Now().UnixNano())
+
 		c.activeHandles.Add(1)
+		id := c.inFlight.add(response, event)
 		go func() {
 			defer c.activeHandles.Done()
-			c.Serve(response, event)
+			defer c.inFlight.remove(id)
+			c.serveEvent(ctx, response, event)
 		}()
 	}
 }
 
+// pauseSource pauses the source if it supports it and paused is not set
+// yet, so it stops fetching events while the consumer is paused or
+// throttled.
+func (c *Consumer) pauseSource(paused *bool) error {
+	source, ok := c.source.(PausableSource)
+	if !ok || *paused {
+		return nil
+	}
+	if err := source.Pause(); err != nil {
+		return fmt.Errorf("failed to pause source: %w", err)
+	}
+	*paused = true
+	return nil
+}
+
+// resumeSource resumes the source if pauseSource paused it.
+func (c *Consumer) resumeSource(paused *bool) error {
+	if !*paused {
+		return nil
+	}
+	if err := c.source.(PausableSource).Resume(); err != nil {
+		return fmt.Errorf("failed to resume source: %w", err)
+	}
+	*paused = false
+	return nil
+}
+
+func (c *Consumer) throttlePause() time.Duration {
+	if c.ThrottlePause <= 0 {
+		return defaultThrottlePause
+	}
+	return c.ThrottlePause
+}
+
+func (c *Consumer) serveEvent(ctx context.Context, r Response, e *Event) {
+	if c.EventContext != nil {
+		ctx = c.EventContext(ctx, e)
+		if ctx == nil {
+			panic("EventContext returned a nil context")
+		}
+	}
+
+	if c.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.HandlerTimeout)
+		defer cancel()
+	}
+
+	if c.Metrics != nil {
+		c.Metrics.EventStarted(e.Subject)
+
+		outcome := RecordOutcome(r)
+		r = outcome
+
+		start := time.Now()
+		defer func() {
+			if p := recover(); p != nil {
+				c.Metrics.HandlerPanicked(e.Subject)
+				panic(p)
+			}
+			c.Metrics.EventHandled(e.Subject, outcome.Outcome(), time.Since(start))
+		}()
+	}
+
+	c.Serve(r, e.WithContext(ctx))
+}
+
+func (c *Consumer) canRestart(err error, attempt int) bool {
+	if c.Restart == nil {
+		return false
+	}
+	if c.Restart.MaxAttempts > 0 && attempt >= c.Restart.MaxAttempts {
+		return false
+	}
+	return c.Restart.isTransient(err)
+}
+
+// stopSource stops the source if it is running. It must only be called by
+// the consume loop, or once it has returned. A nil ctx gives the source
+// defaultStopTimeout to stop.
+func (c *Consumer) stopSource(ctx context.Context) error {
+	c.mu.Lock()
+	running := c.sourceRunning
+	c.sourceRunning = false
+	c.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), defaultStopTimeout)
+		defer cancel()
+	}
+
+	return c.source.Stop(ctx)
+}
+
+// sleep waits for d, returning false if quit was closed meanwhile.
+func sleep(quit chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-quit:
+		return false
+	}
+}
+
+// Pause stops handing out new events until Resume is called. In-flight
+// handlers finish normally, and an event the source is already fetching is
+// still handled. If the source is a PausableSource it is paused as well. A
+// consumer can be paused before it is started, and stays paused when it is
+// restarted.
+func (c *Consumer) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues handing out events after Pause.
+func (c *Consumer) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+		c.resumedAt = time.Now()
+	}
+}
+
+// Paused reports whether the consumer is paused.
+func (c *Consumer) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed != nil
+}
+
+// InFlight returns the events being handled, oldest first.
+func (c *Consumer) InFlight() []InFlightEvent {
+	return c.inFlight.list()
+}
+
+// Shutdown gracefully stops the consumer. It stops handing out new events,
+// waits for in-flight handlers to finish and then stops the source. If ctx
+// is done before that, the contexts of in-flight events are cancelled, the
+// source is stopped right away and ctx's error is returned.
 func (c *Consumer) Shutdown(ctx context.Context) error {
-	if !c.isRunning.Load() {
-		return fmt.Errorf("consumer is not running")
+	if _, ok := c.transition(StateDraining, StateRunning, StateRestarting); !ok {
+		return errNotRunning
 	}
 
-	err := c.source.Stop(ctx)
+	c.mu.Lock()
+	c.closeQuit()
+	loopDone, done, cancelEvents := c.loopDone, c.done, c.cancelEvents
+	c.mu.Unlock()
+
+	err := waitCtx(ctx, loopDone, done)
+	if err == nil {
+		// Wait for all active handles to finish
+		err = waitCtx(ctx, waitGroupDone(&c.activeHandles), done)
+	}
+
+	cancelEvents()
+
 	if err != nil {
-		return fmt.Errorf("failed to stop source: %w", err)
+		<-loopDone // Next returns in a timely manner, the source must not be in use
 	}
 
-	c.inShutdown.Swap(true)
+	if stopErr := c.stopSource(ctx); stopErr != nil && err == nil {
+		err = fmt.Errorf("failed to stop source: %w", stopErr)
+	}
+
+	c.transition(StateStopped, StateDraining)
 
-	// Wait for all active handles to finish
-	if waitCtx(&c.activeHandles, ctx) {
-		return ctx.Err() // Context was cancelled
+	return err
+}
+
+// closeQuit makes the consume loop return. Shutdown and Close may both call
+// it, so only the first call closes quit. c.mu must be held.
+func (c *Consumer) closeQuit() {
+	if !c.quitClosed {
+		close(c.quit)
+		c.quitClosed = true
 	}
+}
+
+// Close immediately stops the consumer and its source without waiting for
+// in-flight handlers, cancelling their event contexts. Their responses are
+// still passed on to the source, which may or may not be able to deliver
+// them.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	switch c.state {
+	case StateRunning, StateRestarting, StateDraining:
+		c.closeQuit()
+	default:
+		c.mu.Unlock()
+		return errNotRunning
+	}
+	loopDone, cancelEvents := c.loopDone, c.cancelEvents
+	c.mu.Unlock()
+
+	cancelEvents()
+	<-loopDone
 
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.stopSource(ctx)
+
+	c.transition(StateStopped, StateRunning, StateRestarting, StateDraining)
+
+	if err != nil {
+		return fmt.Errorf("failed to stop source: %w", err)
+	}
 	return nil
 }
 
-func waitCtx(wg *sync.WaitGroup, ctx context.Context) bool {
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
 	c := make(chan struct{})
 	go func() {
 		defer close(c)
 		wg.Wait()
 	}()
+	return c
+}
 
+// waitCtx waits for ch to be closed. It returns ctx's error if ctx is done
+// first, or ErrConsumerStopped if the consumer was closed meanwhile.
+func waitCtx(ctx context.Context, ch, closed <-chan struct{}) error {
 	select {
-	case <-c:
-		return false // Completed normally
+	case <-ch:
+		return nil
 	case <-ctx.Done():
-		return true // Context was cancelled
+		return ctx.Err()
+	case <-closed:
+		return ErrConsumerStopped
+	}
+}
+
+// InFlightEvent is an event being handled by a Consumer.
+type InFlightEvent struct {
+	Subject string
+
+	// Started is when the consumer started handling the event.
+	Started time.Time
+
+	// Attempt is the delivery attempt of the event, or 0 if the source does
+	// not report it.
+	Attempt uint64
+}
+
+// inFlightEvents keeps track of the events being handled.
+type inFlightEvents struct {
+	mu     sync.Mutex
+	nextID uint64
+	events map[uint64]inFlightEvent
+}
+
+type inFlightEvent struct {
+	subject  string
+	started  time.Time
+	response Response
+}
+
+func (f *inFlightEvents) add(r Response, e *Event) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.events == nil {
+		f.events = make(map[uint64]inFlightEvent)
+	}
+	f.nextID++
+	f.events[f.nextID] = inFlightEvent{subject: e.Subject, started: time.Now(), response: r}
+	return f.nextID
+}
+
+func (f *inFlightEvents) remove(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.events, id)
+}
+
+// oldest returns the number of events being handled, and when the consumer
+// started handling the oldest of them.
+func (f *inFlightEvents) oldest() (int, time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var oldest time.Time
+	for _, e := range f.events {
+		if oldest.IsZero() || e.started.Before(oldest) {
+			oldest = e.started
+		}
+	}
+	return len(f.events), oldest
+}
+
+func (f *inFlightEvents) list() []InFlightEvent {
+	f.mu.Lock()
+	events := make([]inFlightEvent, 0, len(f.events))
+	for _, e := range f.events {
+		events = append(events, e)
+	}
+	f.mu.Unlock()
+
+	slices.SortFunc(events, func(a, b inFlightEvent) int {
+		return a.started.Compare(b.started)
+	})
+
+	list := make([]InFlightEvent, len(events))
+	for i, e := range events {
+		list[i] = InFlightEvent{Subject: e.subject, Started: e.started, Attempt: NumDelivered(e.response)}
 	}
+	return list
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -125,15 +126,7 @@ func TestShutdown(t *testing.T) {
 		})
 
 		c := cone.New(s, h)
-
-		var consumerHasStopped atomic.Bool
-		go func() {
-			err := c.ListenAndConsume()
-			if !errors.Is(err, cone.ErrConsumerStopped) {
-				panic(fmt.Sprintf("Unexpected error: %s", err.Error()))
-			}
-			consumerHasStopped.Swap(true)
-		}()
+		stopped := startConsumer(t, c)
 
 		time.Sleep(5 * time.Millisecond)
 
@@ -142,9 +135,7 @@ func TestShutdown(t *testing.T) {
 			t.Fatalf("Expected nil but got err: %s", err.Error())
 		}
 
-		if !consumerHasStopped.Load() {
-			t.Fatal("Consumer never stopped!")
-		}
+		waitStopped(t, stopped)
 
 		numAcked := s.NumAckd()
 		if numAcked != 1 {
@@ -156,24 +147,548 @@ func TestShutdown(t *testing.T) {
 		s := conetest.NewSource()
 		h := cone.NewHandlerMux()
 		c := cone.New(s, h)
+		stopped := startConsumer(t, c)
+
+		time.Sleep(5 * time.Millisecond)
+		err := c.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+
+		waitStopped(t, stopped)
+	})
+
+	t.Run("Should stop the source after handles are done", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+
+		var sourceRunningInHandler atomic.Bool
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			time.Sleep(50 * time.Millisecond)
+			sourceRunningInHandler.Store(s.IsRunning())
+			_ = r.Ack()
+		}
+
+		c := cone.New(s, handler)
+		stopped := startConsumer(t, c)
+
+		time.Sleep(5 * time.Millisecond)
+		err := c.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		if !sourceRunningInHandler.Load() {
+			t.Fatal("Expected source to be running while the handler was")
+		}
+		if s.IsRunning() {
+			t.Fatal("Expected source to be stopped")
+		}
+		if c.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+		}
+	})
+
+	t.Run("Should return context error when grace period expires", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		release := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			<-release
+		}
+		defer close(release)
+
+		c := cone.New(s, handler)
+		stopped := startConsumer(t, c)
+
+		time.Sleep(5 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := c.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected deadline exceeded but got: %v", err)
+		}
+		waitStopped(t, stopped)
+
+		if s.IsRunning() {
+			t.Fatal("Expected source to be stopped")
+		}
+		if c.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	t.Run("Unstarted consumer should error", func(t *testing.T) {
+		c := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+		if err := c.Close(); err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+	})
+
+	t.Run("Should not wait for handles", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		release := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			<-release
+		}
+		defer close(release)
+
+		c := cone.New(s, handler)
+		stopped := startConsumer(t, c)
+
+		time.Sleep(5 * time.Millisecond)
+		if err := c.Close(); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		select {
+		case <-c.Done():
+		default:
+			t.Fatal("Expected Done to be closed")
+		}
+		if s.IsRunning() {
+			t.Fatal("Expected source to be stopped")
+		}
+	})
 
-		var consumerHasStopped atomic.Bool
+	t.Run("Should interrupt Shutdown", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		release := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			<-release
+		}
+		defer close(release)
+
+		c := cone.New(s, handler)
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+
+		shutdownErr := make(chan error, 1)
 		go func() {
-			err := c.ListenAndConsume()
+			shutdownErr <- c.Shutdown(context.Background())
+		}()
+		time.Sleep(5 * time.Millisecond)
+
+		if err := c.Close(); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		select {
+		case err := <-shutdownErr:
 			if !errors.Is(err, cone.ErrConsumerStopped) {
-				panic(fmt.Sprintf("Unexpected error: %s", err.Error()))
+				t.Fatalf("Expected ErrConsumerStopped but got: %v", err)
 			}
-			consumerHasStopped.Swap(true)
-		}()
+		case <-time.After(time.Second):
+			t.Fatal("Shutdown never returned")
+		}
+	})
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Run("States", func(t *testing.T) {
+		s := conetest.NewSource()
+		c := cone.New(s, cone.NewHandlerMux())
+
+		var mu sync.Mutex
+		var states []cone.State
+		c.OnStateChange = func(_, to cone.State) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, to)
+		}
+
+		if c.State() != cone.StateIdle {
+			t.Fatalf("Expected state %s but got %s", cone.StateIdle, c.State())
+		}
 
+		stopped := startConsumer(t, c)
 		time.Sleep(5 * time.Millisecond)
-		err := c.Shutdown(context.Background())
-		if err != nil {
+		if c.State() != cone.StateRunning {
+			t.Fatalf("Expected state %s but got %s", cone.StateRunning, c.State())
+		}
+
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		mu.Lock()
+		defer mu.Unlock()
+		expected := []cone.State{cone.StateRunning, cone.StateDraining, cone.StateStopped}
+		if fmt.Sprint(states) != fmt.Sprint(expected) {
+			t.Fatalf("Expected states %v but got %v", expected, states)
+		}
+	})
+
+	t.Run("Stopped consumer can be restarted", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			_ = r.Ack()
+		}
+		c := cone.New(s, handler)
+
+		for i := 0; i < 2; i++ {
+			stopped := startConsumer(t, c)
+			time.Sleep(5 * time.Millisecond)
+			if err := c.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Expected nil but got err: %s", err.Error())
+			}
+			waitStopped(t, stopped)
+			s.AddEvent(conetest.NewEvent("event.subject", nil))
+		}
+
+		if s.NumAckd() != 2 {
+			t.Fatalf("Expected 2 acked messages but got: %d", s.NumAckd())
+		}
+	})
+
+	t.Run("Concurrent Close and Shutdown", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			c := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+			stopped := startConsumer(t, c)
+			time.Sleep(time.Millisecond)
+
+			var wg sync.WaitGroup
+			stops := []func(){
+				func() { _ = c.Close() },
+				func() { _ = c.Close() },
+				func() { _ = c.Shutdown(context.Background()) },
+				func() { _ = c.Shutdown(context.Background()) },
+			}
+			for _, stop := range stops {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					stop()
+				}()
+			}
+			wg.Wait()
+			waitStopped(t, stopped)
+
+			if c.State() != cone.StateStopped {
+				t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+			}
+		}
+	})
+
+	t.Run("Fatal source error stops the consumer", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddError(errors.New("fatal"))
+		c := cone.New(s, cone.NewHandlerMux())
+
+		if err := c.ListenAndConsume(); err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+
+		select {
+		case <-c.Done():
+		default:
+			t.Fatal("Expected Done to be closed")
+		}
+		if s.IsRunning() {
+			t.Fatal("Expected source to be stopped")
+		}
+	})
+}
+
+func TestEventContext(t *testing.T) {
+	type ctxKey struct{}
+
+	t.Run("Base and event context", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+
+		values := make(chan string, 2)
+		var handler cone.HandlerFunc = func(r cone.Response, e *cone.Event) {
+			values <- e.Context().Value(ctxKey{}).(string)
+			_ = r.Ack()
+		}
+
+		c := cone.New(s, handler)
+		c.BaseContext = func() context.Context {
+			return context.WithValue(context.Background(), ctxKey{}, "base")
+		}
+		c.EventContext = func(ctx context.Context, e *cone.Event) context.Context {
+			values <- ctx.Value(ctxKey{}).(string)
+			return context.WithValue(ctx, ctxKey{}, e.Subject)
+		}
+
+		stopped := startConsumer(t, c)
+		defer waitStopped(t, stopped)
+		defer c.Shutdown(context.Background())
+
+		for _, expected := range []string{"base", "event.subject"} {
+			select {
+			case value := <-values:
+				if value != expected {
+					t.Fatalf("Expected context value '%s' but got '%s'", expected, value)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Event was never served")
+			}
+		}
+	})
+
+	t.Run("Handler timeout", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+
+		hasDeadline := make(chan bool, 1)
+		var handler cone.HandlerFunc = func(r cone.Response, e *cone.Event) {
+			_, ok := e.Context().Deadline()
+			hasDeadline <- ok
+		}
+
+		c := cone.New(s, handler)
+		c.HandlerTimeout = time.Second
+
+		stopped := startConsumer(t, c)
+		defer waitStopped(t, stopped)
+		defer c.Shutdown(context.Background())
+
+		select {
+		case ok := <-hasDeadline:
+			if !ok {
+				t.Fatal("Expected event context to have a deadline")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Event was never served")
+		}
+	})
+
+	t.Run("Cancelled when grace period expires", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+
+		handling := make(chan struct{})
+		cancelled := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, e *cone.Event) {
+			close(handling)
+			<-e.Context().Done()
+			close(cancelled)
+		}
+
+		c := cone.New(s, handler)
+		stopped := startConsumer(t, c)
+		<-handling
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := c.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected deadline exceeded but got: %v", err)
+		}
+		waitStopped(t, stopped)
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("Event context was never cancelled")
+		}
+	})
+}
+
+// startConsumer runs ListenAndConsume in the background and returns a
+// channel that is closed when it returns. Unexpected errors panic.
+func startConsumer(t *testing.T, c *cone.Consumer) <-chan struct{} {
+	t.Helper()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		err := c.ListenAndConsume()
+		if !errors.Is(err, cone.ErrConsumerStopped) {
+			panic(fmt.Sprintf("Unexpected error: %v", err))
+		}
+	}()
+	return stopped
+}
+
+func waitStopped(t *testing.T, stopped <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Consumer never stopped!")
+	}
+}
+
+func TestPause(t *testing.T) {
+	t.Run("Paused consumer should not hand out events", func(t *testing.T) {
+		s := conetest.NewSource()
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			_ = r.Ack()
+		}
+		c := cone.New(s, handler)
+		c.Pause()
+		if !c.Paused() {
+			t.Fatal("Expected consumer to be paused")
+		}
+
+		stopped := startConsumer(t, c)
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		time.Sleep(20 * time.Millisecond)
+		if s.NumAckd() != 0 {
+			t.Fatalf("Expected no acked events but got %d", s.NumAckd())
+		}
+		if !s.IsPaused() {
+			t.Fatal("Expected source to be paused")
+		}
+
+		c.Resume()
+		time.Sleep(20 * time.Millisecond)
+		if s.NumAckd() != 1 {
+			t.Fatalf("Expected 1 acked event but got %d", s.NumAckd())
+		}
+		if s.IsPaused() {
+			t.Fatal("Expected source to be resumed")
+		}
+
+		if err := c.Shutdown(context.Background()); err != nil {
 			t.Fatalf("Expected nil but got err: %s", err.Error())
 		}
+		waitStopped(t, stopped)
+	})
+
+	t.Run("Paused consumer should shut down", func(t *testing.T) {
+		c := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+		c.Pause()
 
-		if !consumerHasStopped.Load() {
-			t.Fatal("Consumer never stopped!")
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
 		}
+		waitStopped(t, stopped)
 	})
 }
+
+func TestInFlight(t *testing.T) {
+	s := conetest.NewSource()
+	s.AddEvent(conetest.NewEvent("event.first", nil))
+	block := make(chan struct{})
+	var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+		<-block
+		_ = r.Ack()
+	}
+	c := cone.New(s, handler)
+
+	stopped := startConsumer(t, c)
+	time.Sleep(5 * time.Millisecond)
+	s.AddEvent(conetest.NewEvent("event.second", nil))
+	time.Sleep(20 * time.Millisecond)
+
+	events := c.InFlight()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events in flight but got %d", len(events))
+	}
+	if events[0].Subject != "event.first" || events[1].Subject != "event.second" {
+		t.Fatalf("Expected oldest event first but got %s, %s", events[0].Subject, events[1].Subject)
+	}
+
+	close(block)
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected nil but got err: %s", err.Error())
+	}
+	waitStopped(t, stopped)
+
+	if events := c.InFlight(); len(events) != 0 {
+		t.Fatalf("Expected no events in flight but got %d", len(events))
+	}
+}
+
+type throttle struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (t *throttle) Delay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Until(t.until)
+}
+
+func (t *throttle) set(until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.until = until
+}
+
+func TestThrottle(t *testing.T) {
+	s := conetest.NewSource()
+	s.AddEvent(conetest.NewEvent("event.subject", nil))
+	var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+		_ = r.Ack()
+	}
+	c := cone.New(s, handler)
+	c.Throttle = &throttle{until: time.Now().Add(50 * time.Millisecond)}
+
+	stopped := startConsumer(t, c)
+	time.Sleep(20 * time.Millisecond)
+	if s.NumAckd() != 0 {
+		t.Fatalf("Expected no acked events while throttled but got %d", s.NumAckd())
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if s.NumAckd() != 1 {
+		t.Fatalf("Expected 1 acked event but got %d", s.NumAckd())
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected nil but got err: %s", err.Error())
+	}
+	waitStopped(t, stopped)
+}
+
+func TestThrottlePause(t *testing.T) {
+	s := conetest.NewSource()
+	var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+		_ = r.Ack()
+	}
+	c := cone.New(s, handler)
+	th := &throttle{until: time.Now().Add(20 * time.Millisecond)}
+	c.ThrottlePause = 50 * time.Millisecond
+	c.Throttle = th
+
+	stopped := startConsumer(t, c)
+	time.Sleep(5 * time.Millisecond)
+	if s.IsPaused() {
+		t.Fatal("Expected source not to be paused for a short delay")
+	}
+
+	th.set(time.Now().Add(100 * time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+	if !s.IsPaused() {
+		t.Fatal("Expected source to be paused while throttled")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s.IsPaused() {
+		t.Fatal("Expected source to be resumed once no longer throttled")
+	}
+	s.AddEvent(conetest.NewEvent("event.subject", nil))
+	time.Sleep(20 * time.Millisecond)
+	if s.NumAckd() != 1 {
+		t.Fatalf("Expected 1 acked event but got %d", s.NumAckd())
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected nil but got err: %s", err.Error())
+	}
+	waitStopped(t, stopped)
+}
+
+func TestMultiThrottle(t *testing.T) {
+	now := time.Now()
+	m := cone.MultiThrottle(&throttle{until: now.Add(time.Second)}, &throttle{until: now.Add(time.Hour)})
+	if d := m.Delay(); d < 59*time.Minute {
+		t.Fatalf("Expected the longest delay but got %s", d)
+	}
+}
@@ -0,0 +1,228 @@
+package encrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+const (
+	// KeyIDHeader holds the ID of the key the data key was encrypted with.
+	KeyIDHeader = "encryption-key-id"
+
+	// DataKeyHeader holds the encrypted data key, base64 encoded.
+	DataKeyHeader = "encryption-data-key"
+)
+
+const dataKeySize = 32
+
+// DefaultUnknownKeyDelay is how long events encrypted with an unknown key
+// are delayed for by default.
+const DefaultUnknownKeyDelay = 30 * time.Second
+
+var (
+	ErrUnknownKey   = errors.New("unknown encryption key")
+	ErrNotEncrypted = errors.New("event is not encrypted")
+	ErrDecrypt      = errors.New("failed to decrypt")
+)
+
+// KeyProvider provides the keys used to encrypt the data keys of events.
+// Several keys can be active at once, so keys can be rotated without
+// breaking events encrypted with an older key.
+type KeyProvider interface {
+	// Key returns the key with id. It returns an error wrapping
+	// ErrUnknownKey if there is no such key.
+	Key(id string) ([]byte, error)
+
+	// CurrentKey returns the key to encrypt new events with, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+}
+
+// Encrypter encrypts the bodies of published events using envelope
+// encryption: each body is encrypted with AES-GCM under a new data key, and
+// the data key is encrypted with the current key of Keys and attached in the
+// headers.
+type Encrypter struct {
+	Keys KeyProvider
+}
+
+// Publisher returns a publisher encrypting events before passing them to
+// next.
+func (enc *Encrypter) Publisher(next cone.Publisher) cone.Publisher {
+	return cone.PublisherFunc(func(ctx context.Context, e *cone.Event) error {
+		encrypted, err := enc.Encrypt(e)
+		if err != nil {
+			return err
+		}
+		return next.Publish(ctx, encrypted)
+	})
+}
+
+// Encrypt returns a copy of e with its body encrypted.
+func (enc *Encrypter) Encrypt(e *cone.Event) (*cone.Event, error) {
+	id, key, err := enc.Keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	body, err := seal(dataKey, e.Body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key ID is authenticated with the data key, so it can not be
+	// swapped for another.
+	wrapped, err := seal(key, dataKey, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := e.WithContext(e.Context())
+	encrypted.Body = body
+	encrypted.Header = maps.Clone(e.Header)
+	if encrypted.Header == nil {
+		encrypted.Header = make(cone.Header)
+	}
+	encrypted.Header.Set(KeyIDHeader, id)
+	encrypted.Header.Set(DataKeyHeader, base64.StdEncoding.EncodeToString(wrapped))
+
+	return encrypted, nil
+}
+
+// Decrypter decrypts event bodies encrypted by an Encrypter.
+type Decrypter struct {
+	Keys KeyProvider
+
+	// AllowPlaintext passes events without encryption headers on as is.
+	// Otherwise they are treated as failing to decrypt.
+	AllowPlaintext bool
+
+	// OnError responds to events that could not be decrypted. If nil, events
+	// encrypted with an unknown key are Nak'd with UnknownKeyDelay, as the
+	// key may not have been rolled out yet, and other events are terminated
+	// with cone.Term.
+	OnError func(r cone.Response, e *cone.Event, err error)
+
+	// UnknownKeyDelay is how long events encrypted with an unknown key are
+	// delayed for before they are redelivered. If zero,
+	// DefaultUnknownKeyDelay is used.
+	UnknownKeyDelay time.Duration
+}
+
+// Middleware decrypts events before passing them to next. The event passed
+// on has the decrypted body, and no encryption headers.
+func (dec *Decrypter) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		if dec.AllowPlaintext && e.Header.Get(KeyIDHeader) == "" {
+			next.Serve(r, e)
+			return
+		}
+
+		decrypted, err := dec.Decrypt(e)
+		if err != nil {
+			switch {
+			case dec.OnError != nil:
+				dec.OnError(r, e, err)
+			case errors.Is(err, ErrUnknownKey):
+				_ = cone.NakWithDelay(r, dec.unknownKeyDelay())
+			default:
+				_ = cone.Term(r)
+			}
+			return
+		}
+
+		next.Serve(r, decrypted)
+	})
+}
+
+func (dec *Decrypter) unknownKeyDelay() time.Duration {
+	if dec.UnknownKeyDelay == 0 {
+		return DefaultUnknownKeyDelay
+	}
+	return dec.UnknownKeyDelay
+}
+
+// Decrypt returns a copy of e with its body decrypted.
+func (dec *Decrypter) Decrypt(e *cone.Event) (*cone.Event, error) {
+	id := e.Header.Get(KeyIDHeader)
+	encodedDataKey := e.Header.Get(DataKeyHeader)
+	if id == "" || encodedDataKey == "" {
+		return nil, ErrNotEncrypted
+	}
+
+	key, err := dec.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(encodedDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w data key: %w", ErrDecrypt, err)
+	}
+
+	dataKey, err := open(key, wrapped, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w data key: %w", ErrDecrypt, err)
+	}
+
+	body, err := open(dataKey, e.Body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w body: %w", ErrDecrypt, err)
+	}
+
+	decrypted := e.WithContext(e.Context())
+	decrypted.Body = body
+	decrypted.Header = maps.Clone(e.Header)
+	delete(decrypted.Header, KeyIDHeader)
+	delete(decrypted.Header, DataKeyHeader)
+
+	return decrypted, nil
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing the random nonce.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,178 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/encrypt"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	keys, _ := newKeyProvider(t, "k1", 1)
+	body := []byte(`{"email": "someone@example.com"}`)
+
+	encrypted, err := (&encrypt.Encrypter{Keys: keys}).Encrypt(conetest.NewEvent("users.created", body))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if bytes.Contains(encrypted.Body, []byte("someone")) {
+		t.Fatalf("Expected body to be encrypted")
+	}
+	if encrypted.Header.Get(encrypt.KeyIDHeader) != "k1" {
+		t.Fatalf("Expected key ID k1 but got %q", encrypted.Header.Get(encrypt.KeyIDHeader))
+	}
+
+	decrypted, err := (&encrypt.Decrypter{Keys: keys}).Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if !bytes.Equal(decrypted.Body, body) {
+		t.Fatalf("Expected decrypted body %q but got %q", body, decrypted.Body)
+	}
+	if decrypted.Header.Get(encrypt.KeyIDHeader) != "" || decrypted.Header.Get(encrypt.DataKeyHeader) != "" {
+		t.Fatalf("Expected encryption headers to be removed")
+	}
+
+	t.Run("Tampered body", func(t *testing.T) {
+		tampered := encrypted.WithContext(context.Background())
+		tampered.Body = bytes.Clone(encrypted.Body)
+		tampered.Body[len(tampered.Body)-1] ^= 1
+
+		if _, err := (&encrypt.Decrypter{Keys: keys}).Decrypt(tampered); !errors.Is(err, encrypt.ErrDecrypt) {
+			t.Fatalf("Expected ErrDecrypt but got %v", err)
+		}
+	})
+
+	t.Run("Swapped key ID", func(t *testing.T) {
+		both, _ := newKeyProvider(t, "k1", 1, 2)
+		swapped, _ := (&encrypt.Encrypter{Keys: both}).Encrypt(conetest.NewEvent("users.created", body))
+		swapped.Header.Set(encrypt.KeyIDHeader, "k2")
+
+		if _, err := (&encrypt.Decrypter{Keys: both}).Decrypt(swapped); !errors.Is(err, encrypt.ErrDecrypt) {
+			t.Fatalf("Expected ErrDecrypt but got %v", err)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys, path := newKeyProvider(t, "k1", 1)
+	encrypter := &encrypt.Encrypter{Keys: keys}
+	decrypter := &encrypt.Decrypter{Keys: keys}
+
+	old, _ := encrypter.Encrypt(conetest.NewEvent("users.created", []byte("old")))
+
+	writeKeyFile(t, path, "k2", 1, 2)
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	rotated, _ := encrypter.Encrypt(conetest.NewEvent("users.created", []byte("new")))
+	if rotated.Header.Get(encrypt.KeyIDHeader) != "k2" {
+		t.Fatalf("Expected new events to use k2 but got %q", rotated.Header.Get(encrypt.KeyIDHeader))
+	}
+
+	for _, e := range []*cone.Event{old, rotated} {
+		if _, err := decrypter.Decrypt(e); err != nil {
+			t.Fatalf("Expected events of both keys to decrypt but got %v", err)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	keys, _ := newKeyProvider(t, "k1", 1)
+
+	t.Run("Round trip", func(t *testing.T) {
+		p := conetest.NewPublisher()
+		publisher := (&encrypt.Encrypter{Keys: keys}).Publisher(p)
+		if err := publisher.Publish(context.Background(), conetest.NewEvent("users.created", []byte("pii"))); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		var body string
+		handler := (&encrypt.Decrypter{Keys: keys}).Middleware(cone.HandlerFunc(func(_ cone.Response, e *cone.Event) {
+			body = string(e.Body)
+		}))
+		handler.Serve(conetest.NewRecorder(), p.Events()[0])
+
+		if body != "pii" {
+			t.Fatalf("Expected handler to get decrypted body but got %q", body)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		event    func() *cone.Event
+		expected string
+	}{
+		{
+			name:     "Plaintext is terminated",
+			event:    func() *cone.Event { return conetest.NewEvent("users.created", []byte("pii")) },
+			expected: conetest.Term,
+		},
+		{
+			name: "Unknown key is Nak'd",
+			event: func() *cone.Event {
+				other, _ := newKeyProvider(t, "k9", 9)
+				e, _ := (&encrypt.Encrypter{Keys: other}).Encrypt(conetest.NewEvent("users.created", []byte("pii")))
+				return e
+			},
+			expected: conetest.Nak,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			handler := (&encrypt.Decrypter{Keys: keys}).Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+				called = true
+			}))
+
+			r := conetest.NewRecorder()
+			handler.Serve(r, test.event())
+			if called {
+				t.Fatalf("Expected handler not to be called")
+			}
+			if r.Result() != test.expected {
+				t.Fatalf("Expected %s but got %s", test.expected, r.Result())
+			}
+		})
+	}
+
+	t.Run("Unknown key is delayed", func(t *testing.T) {
+		other, _ := newKeyProvider(t, "k9", 9)
+		e, err := (&encrypt.Encrypter{Keys: other}).Encrypt(conetest.NewEvent("users.created", []byte("pii")))
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+
+		for _, dec := range []*encrypt.Decrypter{{Keys: keys}, {Keys: keys, UnknownKeyDelay: time.Second}} {
+			expected := dec.UnknownKeyDelay
+			if expected == 0 {
+				expected = encrypt.DefaultUnknownKeyDelay
+			}
+
+			r := conetest.NewRecorder()
+			dec.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {})).Serve(r, e)
+			if r.Result() != conetest.Nak || r.Delay() != expected {
+				t.Fatalf("Expected %s with delay %s but got %s with %s", conetest.Nak, expected, r.Result(), r.Delay())
+			}
+		}
+	})
+
+	t.Run("AllowPlaintext", func(t *testing.T) {
+		called := false
+		handler := (&encrypt.Decrypter{Keys: keys, AllowPlaintext: true}).Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+			called = true
+		}))
+
+		handler.Serve(conetest.NewRecorder(), conetest.NewEvent("users.created", []byte("public")))
+		if !called {
+			t.Fatalf("Expected handler to be called")
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var _ KeyProvider = &FileKeyProvider{}
+
+// FileKeyProvider reads keys from a JSON file like:
+//
+//	{
+//	  "current": "2024-06",
+//	  "keys": {
+//	    "2024-01": "<base64 encoded key>",
+//	    "2024-06": "<base64 encoded key>"
+//	  }
+//	}
+//
+// Keys are 16, 24 or 32 bytes, selecting AES-128, AES-192 or AES-256. To
+// rotate keys, add the new key, make it current once every consumer has it,
+// and call Reload.
+type FileKeyProvider struct {
+	path string
+
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider returns a FileKeyProvider with the keys in the file at
+// path.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the keys from the file again. The keys are left as they were
+// if the file is invalid.
+func (p *FileKeyProvider) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", id, err)
+		}
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return fmt.Errorf("key %s: invalid size %d, expected 16, 24 or 32 bytes", id, len(key))
+		}
+		keys[id] = key
+	}
+
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("current key %q not in key file", file.Current)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = file.Current
+	p.keys = keys
+
+	return nil
+}
+
+func (p *FileKeyProvider) Key(id string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+func (p *FileKeyProvider) CurrentKey() (string, []byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current, p.keys[p.current], nil
+}
@@ -0,0 +1,110 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zapling/cone/encrypt"
+)
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// writeKeyFile writes a key file with current as the current key, and keys
+// named after their byte.
+func writeKeyFile(t *testing.T, path, current string, keys ...byte) {
+	t.Helper()
+
+	entries := ""
+	for i, b := range keys {
+		if i > 0 {
+			entries += ","
+		}
+		entries += fmt.Sprintf("%q: %q", fmt.Sprintf("k%d", b), base64.StdEncoding.EncodeToString(key(b)))
+	}
+
+	data := fmt.Sprintf(`{"current": %q, "keys": {%s}}`, current, entries)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %s", err.Error())
+	}
+}
+
+func newKeyProvider(t *testing.T, current string, keys ...byte) (*encrypt.FileKeyProvider, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, current, keys...)
+
+	p, err := encrypt.NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("Failed to load key file: %s", err.Error())
+	}
+	return p, path
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	t.Run("Keys", func(t *testing.T) {
+		p, _ := newKeyProvider(t, "k2", 1, 2)
+
+		id, current, err := p.CurrentKey()
+		if err != nil || id != "k2" || !bytes.Equal(current, key(2)) {
+			t.Fatalf("Expected current key k2 but got %q, %v", id, err)
+		}
+
+		if k, err := p.Key("k1"); err != nil || !bytes.Equal(k, key(1)) {
+			t.Fatalf("Expected key k1 but got %v", err)
+		}
+
+		if _, err := p.Key("k3"); !errors.Is(err, encrypt.ErrUnknownKey) {
+			t.Fatalf("Expected ErrUnknownKey but got %v", err)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		p, path := newKeyProvider(t, "k1", 1)
+
+		writeKeyFile(t, path, "k2", 1, 2)
+		if err := p.Reload(); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if id, _, _ := p.CurrentKey(); id != "k2" {
+			t.Fatalf("Expected current key k2 after reload but got %q", id)
+		}
+
+		if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+			t.Fatalf("Failed to write key file: %s", err.Error())
+		}
+		if err := p.Reload(); err == nil {
+			t.Fatalf("Expected invalid key file to fail reloading")
+		}
+		if id, _, _ := p.CurrentKey(); id != "k2" {
+			t.Fatalf("Expected keys to be kept but got current key %q", id)
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		tests := map[string]string{
+			"Missing current key": `{"current": "k9", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(key(1)) + `"}}`,
+			"Invalid key size":    `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString([]byte("short")) + `"}}`,
+			"Invalid base64":      `{"current": "k1", "keys": {"k1": "!"}}`,
+		}
+
+		for name, data := range tests {
+			t.Run(name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "keys.json")
+				if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+					t.Fatalf("Failed to write key file: %s", err.Error())
+				}
+				if _, err := encrypt.NewFileKeyProvider(path); err == nil {
+					t.Fatalf("Expected error loading key file")
+				}
+			})
+		}
+	})
+}
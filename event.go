@@ -18,6 +18,9 @@ type Event struct {
 }
 
 func (e *Event) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
 	return e.ctx
 }
 
@@ -1,5 +1,10 @@
 package cone
 
+import (
+	"context"
+	"time"
+)
+
 type Handler interface {
 	Serve(Response, *Event)
 }
@@ -10,7 +15,239 @@ func (h HandlerFunc) Serve(r Response, e *Event) {
 	h(r, e)
 }
 
+// ErrHandlerFunc is a handler that reports failure by returning an error.
+// The error is passed on with SetError, so a HandlerMux Naks the events it
+// returns an error for, unless AutoAck is AutoAckNever.
+type ErrHandlerFunc func(Response, *Event) error
+
+func (h ErrHandlerFunc) Serve(r Response, e *Event) {
+	if err := h(r, e); err != nil {
+		SetError(r, err)
+	}
+}
+
+// Middleware wraps a Handler with additional behaviour.
+type Middleware func(Handler) Handler
+
+// Chain composes middleware into one. The first middleware is the outermost
+// one, so Chain(a, b)(h) is a(b(h)).
+func Chain(middleware ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			h = middleware[i](h)
+		}
+		return h
+	}
+}
+
+// TimeoutHandler returns a Handler that runs h with a deadline of d on the
+// event context. Handlers are expected to give up and respond once the
+// context is done.
+func TimeoutHandler(h Handler, d time.Duration) Handler {
+	return HandlerFunc(func(r Response, e *Event) {
+		ctx, cancel := context.WithTimeout(e.Context(), d)
+		defer cancel()
+		h.Serve(r, e.WithContext(ctx))
+	})
+}
+
 type Response interface {
 	Ack() error
 	Nak() error
 }
+
+// ResponseState is implemented by responses that know whether they have
+// been responded to. A HandlerMux wraps the responses it passes to handlers,
+// hiding any methods other than those of the response interfaces of this
+// package, unless AutoAck is AutoAckNever and they implement ResponseState.
+type ResponseState interface {
+	Responded() bool
+}
+
+// responseTracker adds ResponseState to responses that lack it, and collects
+// the error the handler failed with.
+type responseTracker struct {
+	Response
+	responded bool
+	err       error
+}
+
+func (r *responseTracker) Ack() error {
+	r.responded = true
+	return r.Response.Ack()
+}
+
+func (r *responseTracker) Nak() error {
+	r.responded = true
+	return r.Response.Nak()
+}
+
+func (r *responseTracker) NakWithDelay(delay time.Duration) error {
+	r.responded = true
+	return NakWithDelay(r.Response, delay)
+}
+
+func (r *responseTracker) Term() error {
+	r.responded = true
+	return Term(r.Response)
+}
+
+func (r *responseTracker) Responded() bool {
+	if state, ok := r.Response.(ResponseState); ok && state.Responded() {
+		return true
+	}
+	return r.responded
+}
+
+func (r *responseTracker) NumDelivered() uint64 {
+	return NumDelivered(r.Response)
+}
+
+func (r *responseTracker) SetError(err error) {
+	r.err = err
+}
+
+// ErrorResponse is implemented by responses that collect the error a handler
+// failed with, such as the responses a HandlerMux passes to handlers.
+// Middleware wrapping responses should pass the error on with SetError.
+type ErrorResponse interface {
+	Response
+	SetError(err error)
+}
+
+// SetError reports err as the error the handler failed with, if r
+// implements ErrorResponse. Otherwise the error is dropped.
+func SetError(r Response, err error) {
+	if e, ok := r.(ErrorResponse); ok {
+		e.SetError(err)
+	}
+}
+
+// TermResponse is implemented by responses that can tell the source to never
+// redeliver the event.
+type TermResponse interface {
+	Response
+	Term() error
+}
+
+// Term terminates the event if r implements TermResponse. Otherwise the
+// event is Ack'd, which also keeps it from being redelivered.
+func Term(r Response) error {
+	if t, ok := r.(TermResponse); ok {
+		return t.Term()
+	}
+	return r.Ack()
+}
+
+// DelayResponse is implemented by responses that can ask the source to
+// redeliver the event after a delay.
+type DelayResponse interface {
+	Response
+	NakWithDelay(delay time.Duration) error
+}
+
+// NakWithDelay Naks the event, asking for it to be redelivered after delay,
+// if r implements DelayResponse. Otherwise the event is Nak'd without delay.
+func NakWithDelay(r Response, delay time.Duration) error {
+	if d, ok := r.(DelayResponse); ok {
+		return d.NakWithDelay(delay)
+	}
+	return r.Nak()
+}
+
+// DeliveryResponse is implemented by responses of sources that count how
+// many times an event has been delivered.
+type DeliveryResponse interface {
+	Response
+	NumDelivered() uint64
+}
+
+// NumDelivered returns how many times the event has been delivered,
+// including the current delivery, if r implements DeliveryResponse.
+// Otherwise it returns 0.
+func NumDelivered(r Response) uint64 {
+	if d, ok := r.(DeliveryResponse); ok {
+		return d.NumDelivered()
+	}
+	return 0
+}
+
+// Outcome is how an event was responded to.
+type Outcome string
+
+const (
+	OutcomeAck  Outcome = "ack"
+	OutcomeNak  Outcome = "nak"
+	OutcomeTerm Outcome = "term"
+
+	// OutcomeNone is the outcome of events the handler returned from
+	// without responding to.
+	OutcomeNone Outcome = "none"
+)
+
+// OutcomeRecorder wraps a Response, recording how the event was first
+// responded to. Middleware can use it to find out what the handlers it wraps
+// did with an event.
+type OutcomeRecorder struct {
+	Response
+	outcome   Outcome
+	responded bool
+}
+
+// RecordOutcome returns an OutcomeRecorder wrapping r.
+func RecordOutcome(r Response) *OutcomeRecorder {
+	return &OutcomeRecorder{Response: r, outcome: OutcomeNone}
+}
+
+// Outcome returns how the event was first responded to, or OutcomeNone if it
+// has not been. Events terminated through a response that does not implement
+// TermResponse are Ack'd.
+func (r *OutcomeRecorder) Outcome() Outcome {
+	return r.outcome
+}
+
+func (r *OutcomeRecorder) record(outcome Outcome) {
+	if !r.Responded() {
+		r.outcome = outcome
+	}
+	r.responded = true
+}
+
+func (r *OutcomeRecorder) Ack() error {
+	r.record(OutcomeAck)
+	return r.Response.Ack()
+}
+
+func (r *OutcomeRecorder) Nak() error {
+	r.record(OutcomeNak)
+	return r.Response.Nak()
+}
+
+func (r *OutcomeRecorder) NakWithDelay(delay time.Duration) error {
+	r.record(OutcomeNak)
+	return NakWithDelay(r.Response, delay)
+}
+
+func (r *OutcomeRecorder) Term() error {
+	if _, ok := r.Response.(TermResponse); ok {
+		r.record(OutcomeTerm)
+	} else {
+		r.record(OutcomeAck)
+	}
+	return Term(r.Response)
+}
+
+func (r *OutcomeRecorder) Responded() bool {
+	if state, ok := r.Response.(ResponseState); ok && state.Responded() {
+		return true
+	}
+	return r.responded
+}
+
+func (r *OutcomeRecorder) NumDelivered() uint64 {
+	return NumDelivered(r.Response)
+}
+
+func (r *OutcomeRecorder) SetError(err error) {
+	SetError(r.Response, err)
+}
@@ -1,17 +1,212 @@
 package cone
 
-import "fmt"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxNotFoundSubjects caps how many distinct unknown subjects are counted
+// individually, so a misbehaving producer can not grow the mux without bound.
+const maxNotFoundSubjects = 1000
 
 func NewHandlerMux() *HandlerMux {
 	return &HandlerMux{
 		AckUnknownSubjects: false,
-		handlers:           make(map[string]Handler),
+		handlers:           make(map[string]routeEntry),
 	}
 }
 
+// HandlerMux routes events to the handler registered for their subject.
+//
+// Subjects may contain NATS wildcards, and routes registered with
+// HandleMatch can also match on headers. When several routes match an event,
+// the first one in this order handles it:
+//
+//  1. Routes matching on headers, those with the most header predicates
+//     first and then those with the most specific subject.
+//  2. The route for the exact subject.
+//  3. Routes with wildcard subjects, the most specific first. A pattern is
+//     more specific than another if it has more literal tokens, or the same
+//     number but no trailing ">".
+//  4. Routes of mounted muxes, the longest prefix first.
+//
+// Routes that are equally specific are tried in the order they were
+// registered.
+//
+// Routes can be organised under subject prefixes with Group, and muxes
+// built separately can be composed with Mount.
+//
+// Middleware added with Use wraps every route, including routes registered
+// before it was added. It only runs for events with a registered subject,
+// unless MiddlewareOnUnknownSubjects is set.
+//
+// Events without a registered subject are passed to NotFoundHandler.
 type HandlerMux struct {
+	// NotFoundHandler handles events without a registered subject. It is
+	// responsible for responding to the event, for example by terminating it
+	// with Term so it is not redelivered. If nil, the events are Nak'd, or
+	// Ack'd if AckUnknownSubjects is set.
+	NotFoundHandler Handler
+
+	// Deprecated: Use NotFoundHandler.
 	AckUnknownSubjects bool
-	handlers           map[string]Handler
+
+	// MiddlewareOnUnknownSubjects makes events without a registered subject
+	// pass through the middleware added with Use before reaching
+	// NotFoundHandler.
+	MiddlewareOnUnknownSubjects bool
+
+	// AutoAck controls how events are responded to once their handler
+	// returns. Handlers are never responded for twice. Only the setting of
+	// the mux created with NewHandlerMux is used.
+	AutoAck AutoAckMode
+
+	// Metrics, if set, is told about events with unknown subjects. Only the
+	// setting of the mux created with NewHandlerMux is used.
+	Metrics Metrics
+
+	handlers   map[string]routeEntry
+	wildcards  []string // subjects in handlers with wildcards, most specific first
+	matches    []matchEntry
+	mounts     []mount
+	parent     *HandlerMux // set on muxes created by With and Group
+	prefix     string
+	middleware []Middleware
+
+	notFound notFoundCounter
+}
+
+// AutoAckMode controls how a HandlerMux responds to events on behalf of
+// their handlers.
+type AutoAckMode int
+
+const (
+	// AutoAckOnReturn Acks events the handler returned from without
+	// responding to, or Naks them if it failed with an error, such as one
+	// returned by an ErrHandlerFunc.
+	AutoAckOnReturn AutoAckMode = iota
+
+	// AutoAckNever leaves responding entirely to the handler, for example
+	// for handlers that hand events over to background goroutines. Errors
+	// returned by an ErrHandlerFunc are ignored.
+	AutoAckNever
+
+	// Deprecated: AutoAckOnReturn Naks events an ErrHandlerFunc returned an
+	// error for as well.
+	AutoAckOnError
+)
+
+// NotFoundStats counts events a HandlerMux had no route for.
+type NotFoundStats struct {
+	// Total is the number of events without a route.
+	Total uint64
+
+	// Subjects counts the events per subject. Only the first 1000 distinct
+	// subjects are counted, later ones are only included in Total.
+	Subjects map[string]uint64
+}
+
+type notFoundCounter struct {
+	mu       sync.Mutex
+	total    uint64
+	subjects map[string]uint64
+}
+
+func (c *notFoundCounter) add(subject string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total++
+	if c.subjects == nil {
+		c.subjects = make(map[string]uint64)
+	}
+	if _, ok := c.subjects[subject]; ok || len(c.subjects) < maxNotFoundSubjects {
+		c.subjects[subject]++
+	}
+}
+
+func (c *notFoundCounter) stats() NotFoundStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return NotFoundStats{Total: c.total, Subjects: maps.Clone(c.subjects)}
+}
+
+type routeEntry struct {
+	handler Handler
+	mux     *HandlerMux // the mux the route was registered on
+	wrapped *wrappedHandler
+}
+
+func newRouteEntry(handler Handler, mux *HandlerMux) routeEntry {
+	return routeEntry{
+		handler: handler,
+		mux:     mux,
+		wrapped: &wrappedHandler{handler: handler, mux: mux},
+	}
+}
+
+// middlewareGen is incremented whenever middleware is added to a mux, so
+// handlers wrapped with the previous middleware are wrapped again.
+var middlewareGen atomic.Uint64
+
+// wrappedHandler is a handler wrapped with the middleware of mux and its
+// parents, built when first served rather than for every event.
+type wrappedHandler struct {
+	handler Handler
+	inner   *wrappedHandler // replaces handler for routes of mounted muxes
+	mux     *HandlerMux
+
+	mu      sync.Mutex
+	gen     uint64
+	wrapped Handler
+}
+
+func (w *wrappedHandler) get() Handler {
+	gen := middlewareGen.Load()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.wrapped == nil || w.gen != gen {
+		handler := w.handler
+		if w.inner != nil {
+			handler = w.inner.get()
+		}
+		w.wrapped, w.gen = w.mux.wrap(handler), gen
+	}
+	return w.wrapped
+}
+
+type matchEntry struct {
+	matcher Matcher
+	routeEntry
+}
+
+type mount struct {
+	prefix string
+	mux    *HandlerMux
+	at     *HandlerMux // the mux Mount was called on
+
+	mu      *sync.Mutex
+	wrapped map[*wrappedHandler]*wrappedHandler // by route of mux
+}
+
+// wrap returns the route of the mounted mux wrapped with the middleware of
+// the mux it is mounted on.
+func (m mount) wrap(inner *wrappedHandler) *wrappedHandler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.wrapped[inner]
+	if !ok {
+		w = &wrappedHandler{inner: inner, mux: m.at}
+		m.wrapped[inner] = w
+	}
+	return w
 }
 
 func (h *HandlerMux) Handle(subject string, handler Handler) {
@@ -28,33 +223,234 @@ func (h *HandlerMux) HandleFunc(subject string, handlerFunc HandlerFunc) {
 	}
 }
 
+// HandleMatch registers the handler for events matched by m. Matchers
+// without header predicates are the same as routes registered with Handle.
+func (h *HandlerMux) HandleMatch(m Matcher, handler Handler) {
+	if len(m.headers) == 0 {
+		h.Handle(m.subject, handler)
+		return
+	}
+
+	if m.subject == "" {
+		panic("empty subject is not allowed")
+	}
+	m.subject = joinSubject(h.prefix, m.subject)
+
+	root := h.root()
+	root.matches = append(root.matches, matchEntry{
+		matcher:    m,
+		routeEntry: newRouteEntry(handler, h),
+	})
+
+	slices.SortStableFunc(root.matches, func(a, b matchEntry) int {
+		if len(a.matcher.headers) != len(b.matcher.headers) {
+			return len(b.matcher.headers) - len(a.matcher.headers)
+		}
+		return compareSpecificity(a.matcher.subject, b.matcher.subject)
+	})
+}
+
+// Use appends middleware to the mux. The first middleware added is the
+// outermost one. On a mux returned by With, the middleware only applies to
+// routes registered on that mux.
+func (h *HandlerMux) Use(middleware ...Middleware) {
+	h.middleware = append(h.middleware, middleware...)
+	middlewareGen.Add(1)
+}
+
+// With returns a mux for registering routes wrapped with the given
+// middleware, inside the middleware of h. Routes registered on it are served
+// by h.
+func (h *HandlerMux) With(middleware ...Middleware) *HandlerMux {
+	return &HandlerMux{
+		handlers:   h.handlers,
+		parent:     h,
+		prefix:     h.prefix,
+		middleware: middleware,
+	}
+}
+
+// Group calls fn with a mux that registers its routes under prefix, so a
+// handler for "created" in the group "billing.v1" handles the subject
+// "billing.v1.created". Middleware added to the group only applies to its
+// routes. The group mux is also returned.
+func (h *HandlerMux) Group(prefix string, fn func(g *HandlerMux)) *HandlerMux {
+	if prefix == "" {
+		panic("empty subject prefix is not allowed")
+	}
+
+	g := &HandlerMux{
+		handlers: h.handlers,
+		parent:   h,
+		prefix:   joinSubject(h.prefix, prefix),
+	}
+	if fn != nil {
+		fn(g)
+	}
+	return g
+}
+
+// Mount serves events with subjects under prefix using mux, which matches
+// them with prefix removed. The event itself keeps its full subject. Routes
+// registered directly on h take precedence, and the middleware of h wraps
+// the middleware of mux. Unknown subjects are handled by h.
+func (h *HandlerMux) Mount(prefix string, mux *HandlerMux) {
+	if prefix == "" {
+		panic("empty subject prefix is not allowed")
+	}
+	if mux == nil {
+		panic("mounted mux is nil")
+	}
+
+	root := h.root()
+	if mux.root() == root {
+		panic("mux can not be mounted on itself")
+	}
+
+	root.mounts = append(root.mounts, mount{
+		prefix:  joinSubject(h.prefix, prefix),
+		mux:     mux.root(),
+		at:      h,
+		mu:      &sync.Mutex{},
+		wrapped: make(map[*wrappedHandler]*wrappedHandler),
+	})
+
+	// Most specific prefix first
+	slices.SortStableFunc(root.mounts, func(a, b mount) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+}
+
 func (h *HandlerMux) register(subject string, handler Handler) error {
 	if subject == "" {
 		return fmt.Errorf("empty subject is not allowed")
 	}
-	h.handlers[subject] = handler
+	subject = joinSubject(h.prefix, subject)
+	h.handlers[subject] = newRouteEntry(handler, h)
+
+	root := h.root()
+	if hasWildcard(subject) && !slices.Contains(root.wildcards, subject) {
+		root.wildcards = append(root.wildcards, subject)
+		slices.SortStableFunc(root.wildcards, compareSpecificity)
+	}
+
 	return nil
 }
 
+func joinSubject(prefix, subject string) string {
+	if prefix == "" {
+		return subject
+	}
+	return prefix + "." + subject
+}
+
+// root returns the mux that serves the routes registered on h.
+func (h *HandlerMux) root() *HandlerMux {
+	for h.parent != nil {
+		h = h.parent
+	}
+	return h
+}
+
+// wrap wraps handler with the middleware of h and its parents.
+func (h *HandlerMux) wrap(handler Handler) Handler {
+	for mux := h; mux != nil; mux = mux.parent {
+		handler = Chain(mux.middleware...)(handler)
+	}
+	return handler
+}
+
 func (h *HandlerMux) Serve(r Response, e *Event) {
 	if e == nil {
 		panic("event is nil")
 	}
 
-	if err := h.serveEvent(r, e); err != nil {
+	if err := h.root().serveEvent(r, e); err != nil {
 		panic(err)
 	}
 }
 
+// lookup returns the handler for an event with subject and header, wrapped
+// with its middleware.
+func (h *HandlerMux) lookup(subject string, header Header) (*wrappedHandler, bool) {
+	for _, m := range h.matches {
+		if m.matcher.match(subject, header) {
+			return m.wrapped, true
+		}
+	}
+
+	if route, ok := h.handlers[subject]; ok {
+		return route.wrapped, true
+	}
+
+	for _, pattern := range h.wildcards {
+		if SubjectCovers(pattern, subject) {
+			return h.handlers[pattern].wrapped, true
+		}
+	}
+
+	for _, m := range h.mounts {
+		rest, ok := strings.CutPrefix(subject, m.prefix+".")
+		if !ok {
+			continue
+		}
+		if handler, ok := m.mux.lookup(rest, header); ok {
+			return m.wrap(handler), true
+		}
+	}
+
+	return nil, false
+}
+
+// NotFoundStats returns how many events the mux had no route for.
+func (h *HandlerMux) NotFoundStats() NotFoundStats {
+	return h.root().notFound.stats()
+}
+
 func (h *HandlerMux) serveEvent(r Response, e *Event) error {
-	handler, ok := h.handlers[e.Subject]
+	route, ok := h.lookup(e.Subject, e.Header)
 	if !ok {
-		if h.AckUnknownSubjects {
-			return r.Ack()
+		h.notFound.add(e.Subject)
+		if h.Metrics != nil {
+			h.Metrics.UnknownSubject(e.Subject)
 		}
-		return r.Nak()
+
+		var err error
+		handler := h.NotFoundHandler
+		if handler == nil {
+			handler = HandlerFunc(func(r Response, _ *Event) {
+				err = h.respondUnknown(r)
+			})
+		}
+
+		if h.MiddlewareOnUnknownSubjects {
+			handler = h.wrap(handler)
+		}
+
+		handler.Serve(r, e)
+		return err
+	}
+
+	if _, ok := r.(ResponseState); ok && h.AutoAck == AutoAckNever {
+		route.get().Serve(r, e)
+		return nil
 	}
 
-	handler.Serve(r, e)
+	tracker := &responseTracker{Response: r}
+	route.get().Serve(tracker, e)
+
+	if h.AutoAck == AutoAckNever || tracker.Responded() {
+		return nil
+	}
+	if tracker.err != nil {
+		return r.Nak()
+	}
 	return r.Ack()
 }
+
+func (h *HandlerMux) respondUnknown(r Response) error {
+	if h.AckUnknownSubjects {
+		return r.Ack()
+	}
+	return r.Nak()
+}
@@ -1,6 +1,8 @@
 package cone_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/zapling/cone"
@@ -105,6 +107,533 @@ func TestHandlerMiddleware(t *testing.T) {
 	})
 }
 
+// recordingMiddleware returns middleware appending name to calls when run.
+func recordingMiddleware(calls *[]string, name string) cone.Middleware {
+	return func(next cone.Handler) cone.Handler {
+		return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+			*calls = append(*calls, name)
+			next.Serve(r, e)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	t.Run("Runs in order for matched routes", func(t *testing.T) {
+		var calls []string
+		c := cone.NewHandlerMux()
+		c.HandleFunc("event.subject", func(_ cone.Response, _ *cone.Event) {
+			calls = append(calls, "handler")
+		})
+		c.Use(recordingMiddleware(&calls, "first"), recordingMiddleware(&calls, "second"))
+
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+		expected := []string{"first", "second", "handler"}
+		if fmt.Sprint(calls) != fmt.Sprint(expected) {
+			t.Fatalf("Expected calls %v but got %v", expected, calls)
+		}
+	})
+
+	t.Run("Wraps each route once", func(t *testing.T) {
+		var wrapped int
+		counting := func(next cone.Handler) cone.Handler {
+			wrapped++
+			return next
+		}
+
+		billing := cone.NewHandlerMux()
+		billing.Use(counting)
+		billing.HandleFunc("invoice.created", func(_ cone.Response, _ *cone.Event) {})
+
+		c := cone.NewHandlerMux()
+		c.Use(counting)
+		c.HandleFunc("event.subject", func(_ cone.Response, _ *cone.Event) {})
+		c.Mount("billing", billing)
+
+		for range 3 {
+			c.Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+			c.Serve(conetest.NewRecorder(), conetest.NewEvent("billing.invoice.created", nil))
+		}
+		if wrapped != 3 {
+			t.Fatalf("Expected 3 routes wrapped but got %d", wrapped)
+		}
+
+		// Middleware added later wraps the routes again
+		var calls []string
+		billing.Use(recordingMiddleware(&calls, "late"))
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent("billing.invoice.created", nil))
+		if fmt.Sprint(calls) != "[late]" {
+			t.Fatalf("Expected calls [late] but got %v", calls)
+		}
+	})
+
+	t.Run("Skipped for unknown subjects", func(t *testing.T) {
+		var calls []string
+		c := cone.NewHandlerMux()
+		c.Use(recordingMiddleware(&calls, "mw"))
+
+		r := conetest.NewRecorder()
+		c.Serve(r, conetest.NewEvent("not.wanted", nil))
+
+		if len(calls) != 0 {
+			t.Fatalf("Expected no middleware calls but got %v", calls)
+		}
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s but got: %s", conetest.Nak, r.Result())
+		}
+	})
+
+	t.Run("Runs for unknown subjects when requested", func(t *testing.T) {
+		var calls []string
+		c := cone.NewHandlerMux()
+		c.MiddlewareOnUnknownSubjects = true
+		c.Use(recordingMiddleware(&calls, "mw"))
+
+		r := conetest.NewRecorder()
+		c.Serve(r, conetest.NewEvent("not.wanted", nil))
+
+		if len(calls) != 1 {
+			t.Fatalf("Expected one middleware call but got %v", calls)
+		}
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s but got: %s", conetest.Nak, r.Result())
+		}
+	})
+}
+
+func TestWith(t *testing.T) {
+	var calls []string
+	handler := func(name string) cone.HandlerFunc {
+		return func(_ cone.Response, _ *cone.Event) {
+			calls = append(calls, name)
+		}
+	}
+
+	c := cone.NewHandlerMux()
+	c.Use(recordingMiddleware(&calls, "mux"))
+	c.HandleFunc("plain", handler("plain"))
+	scoped := c.With(recordingMiddleware(&calls, "scoped"))
+	scoped.HandleFunc("scoped", handler("scoped"))
+	scoped.With(recordingMiddleware(&calls, "nested")).HandleFunc("nested", handler("nested"))
+
+	tests := []struct {
+		subject  string
+		expected []string
+	}{
+		{"plain", []string{"mux", "plain"}},
+		{"scoped", []string{"mux", "scoped", "scoped"}},
+		{"nested", []string{"mux", "scoped", "nested", "nested"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			calls = nil
+			r := conetest.NewRecorder()
+			c.Serve(r, conetest.NewEvent(tt.subject, nil))
+			if fmt.Sprint(calls) != fmt.Sprint(tt.expected) {
+				t.Fatalf("Expected calls %v but got %v", tt.expected, calls)
+			}
+			if r.Result() != conetest.Ack {
+				t.Fatalf("Expected %s but got: %s", conetest.Ack, r.Result())
+			}
+		})
+	}
+
+	t.Run("Scoped mux serves the same routes", func(t *testing.T) {
+		calls = nil
+		scoped.Serve(conetest.NewRecorder(), conetest.NewEvent("plain", nil))
+		expected := []string{"mux", "plain"}
+		if fmt.Sprint(calls) != fmt.Sprint(expected) {
+			t.Fatalf("Expected calls %v but got %v", expected, calls)
+		}
+	})
+}
+
+func TestGroup(t *testing.T) {
+	t.Run("Empty prefix should panic", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatalf("Expected panic, empty prefix is not allowed")
+			}
+		}()
+
+		cone.NewHandlerMux().Group("", nil)
+	})
+
+	t.Run("Routes are registered under prefix", func(t *testing.T) {
+		var calls []string
+		c := cone.NewHandlerMux()
+		c.Use(recordingMiddleware(&calls, "mux"))
+		c.Group("billing.v1", func(g *cone.HandlerMux) {
+			g.Use(recordingMiddleware(&calls, "billing"))
+			g.HandleFunc("invoice.created", func(_ cone.Response, e *cone.Event) {
+				calls = append(calls, e.Subject)
+			})
+			g.Group("admin", func(g *cone.HandlerMux) {
+				g.HandleFunc("reset", func(_ cone.Response, e *cone.Event) {
+					calls = append(calls, e.Subject)
+				})
+			})
+		})
+		c.HandleFunc("other", func(_ cone.Response, e *cone.Event) {
+			calls = append(calls, e.Subject)
+		})
+
+		tests := []struct {
+			subject  string
+			expected []string
+		}{
+			{"billing.v1.invoice.created", []string{"mux", "billing", "billing.v1.invoice.created"}},
+			{"billing.v1.admin.reset", []string{"mux", "billing", "billing.v1.admin.reset"}},
+			{"other", []string{"mux", "other"}},
+		}
+
+		for _, tt := range tests {
+			calls = nil
+			r := conetest.NewRecorder()
+			c.Serve(r, conetest.NewEvent(tt.subject, nil))
+			if fmt.Sprint(calls) != fmt.Sprint(tt.expected) {
+				t.Fatalf("Expected calls %v but got %v", tt.expected, calls)
+			}
+		}
+
+		r := conetest.NewRecorder()
+		c.Serve(r, conetest.NewEvent("invoice.created", nil))
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s but got: %s", conetest.Nak, r.Result())
+		}
+	})
+}
+
+func TestMount(t *testing.T) {
+	t.Run("Mounting on itself should panic", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatalf("Expected panic, mounting on itself is not allowed")
+			}
+		}()
+
+		c := cone.NewHandlerMux()
+		c.Mount("prefix", c.With())
+	})
+
+	t.Run("Mounted mux serves subjects under prefix", func(t *testing.T) {
+		var calls []string
+
+		billing := cone.NewHandlerMux()
+		billing.Use(recordingMiddleware(&calls, "billing"))
+		billing.HandleFunc("invoice.created", func(_ cone.Response, e *cone.Event) {
+			calls = append(calls, e.Subject)
+		})
+
+		c := cone.NewHandlerMux()
+		c.Use(recordingMiddleware(&calls, "mux"))
+		c.Mount("billing.v1", billing)
+
+		// Routes added after mounting are served too
+		billing.HandleFunc("invoice.paid", func(_ cone.Response, e *cone.Event) {
+			calls = append(calls, e.Subject)
+		})
+
+		tests := []struct {
+			subject  string
+			expected []string
+			result   string
+		}{
+			{"billing.v1.invoice.created", []string{"mux", "billing", "billing.v1.invoice.created"}, conetest.Ack},
+			{"billing.v1.invoice.paid", []string{"mux", "billing", "billing.v1.invoice.paid"}, conetest.Ack},
+			{"billing.v1.unknown", nil, conetest.Nak},
+			{"invoice.created", nil, conetest.Nak},
+		}
+
+		for _, tt := range tests {
+			calls = nil
+			r := conetest.NewRecorder()
+			c.Serve(r, conetest.NewEvent(tt.subject, nil))
+			if fmt.Sprint(calls) != fmt.Sprint(tt.expected) {
+				t.Fatalf("%s: Expected calls %v but got %v", tt.subject, tt.expected, calls)
+			}
+			if r.Result() != tt.result {
+				t.Fatalf("%s: Expected %s but got: %s", tt.subject, tt.result, r.Result())
+			}
+		}
+	})
+
+	t.Run("Mounted in group", func(t *testing.T) {
+		var calls []string
+
+		billing := cone.NewHandlerMux()
+		billing.HandleFunc("invoice.created", func(_ cone.Response, e *cone.Event) {
+			calls = append(calls, e.Subject)
+		})
+
+		c := cone.NewHandlerMux()
+		c.Group("billing", func(g *cone.HandlerMux) {
+			g.Use(recordingMiddleware(&calls, "group"))
+			g.Mount("v1", billing)
+		})
+
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent("billing.v1.invoice.created", nil))
+		expected := []string{"group", "billing.v1.invoice.created"}
+		if fmt.Sprint(calls) != fmt.Sprint(expected) {
+			t.Fatalf("Expected calls %v but got %v", expected, calls)
+		}
+	})
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	t.Run("Handles unknown subjects", func(t *testing.T) {
+		c := cone.NewHandlerMux()
+		c.HandleFunc("is.wanted", func(_ cone.Response, _ *cone.Event) {})
+
+		var notFound []string
+		c.NotFoundHandler = cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+			notFound = append(notFound, e.Subject)
+			_ = cone.Term(r)
+		})
+
+		r := conetest.NewRecorder()
+		c.Serve(r, conetest.NewEvent("not.wanted", nil))
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected %s but got: %s", conetest.Term, r.Result())
+		}
+
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent("is.wanted", nil))
+		if fmt.Sprint(notFound) != "[not.wanted]" {
+			t.Fatalf("Expected NotFoundHandler to be called for not.wanted only, got %v", notFound)
+		}
+	})
+
+	t.Run("Wrapped with middleware when requested", func(t *testing.T) {
+		var calls []string
+		c := cone.NewHandlerMux()
+		c.MiddlewareOnUnknownSubjects = true
+		c.Use(recordingMiddleware(&calls, "mw"))
+		c.NotFoundHandler = cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+			calls = append(calls, "not found")
+		})
+
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent("not.wanted", nil))
+		expected := []string{"mw", "not found"}
+		if fmt.Sprint(calls) != fmt.Sprint(expected) {
+			t.Fatalf("Expected calls %v but got %v", expected, calls)
+		}
+	})
+}
+
+func TestNotFoundStats(t *testing.T) {
+	c := cone.NewHandlerMux()
+	c.HandleFunc("is.wanted", func(_ cone.Response, _ *cone.Event) {})
+
+	for _, subject := range []string{"not.wanted", "is.wanted", "not.wanted", "other"} {
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent(subject, nil))
+	}
+
+	stats := c.With().NotFoundStats()
+	if stats.Total != 3 {
+		t.Fatalf("Expected 3 unknown events but got %d", stats.Total)
+	}
+	if stats.Subjects["not.wanted"] != 2 || stats.Subjects["other"] != 1 || len(stats.Subjects) != 2 {
+		t.Fatalf("Unexpected subject counts: %v", stats.Subjects)
+	}
+}
+
+func TestAutoAck(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		mode     cone.AutoAckMode
+		handler  cone.Handler
+		expected string
+	}{
+		{
+			name:     "Unresponded event is acked",
+			mode:     cone.AutoAckOnReturn,
+			handler:  cone.HandlerFunc(func(_ cone.Response, _ *cone.Event) {}),
+			expected: conetest.Ack,
+		},
+		{
+			name:     "Nak'd event is not acked",
+			mode:     cone.AutoAckOnReturn,
+			handler:  cone.HandlerFunc(func(r cone.Response, _ *cone.Event) { _ = r.Nak() }),
+			expected: conetest.Nak,
+		},
+		{
+			name:     "Returned error is nak'd",
+			mode:     cone.AutoAckOnReturn,
+			handler:  cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return errFailed }),
+			expected: conetest.Nak,
+		},
+		{
+			name: "Returned error is nak'd through outcome recorder",
+			mode: cone.AutoAckOnReturn,
+			handler: cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+				cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return errFailed }).Serve(cone.RecordOutcome(r), e)
+			}),
+			expected: conetest.Nak,
+		},
+		{
+			name:     "Never responds",
+			mode:     cone.AutoAckNever,
+			handler:  cone.HandlerFunc(func(_ cone.Response, _ *cone.Event) {}),
+			expected: "",
+		},
+		{
+			name:     "Returned error is ignored when never responding",
+			mode:     cone.AutoAckNever,
+			handler:  cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return errFailed }),
+			expected: "",
+		},
+		{
+			name:     "Error is nak'd",
+			mode:     cone.AutoAckOnError,
+			handler:  cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return errFailed }),
+			expected: conetest.Nak,
+		},
+		{
+			name: "Error is nak'd through middleware",
+			mode: cone.AutoAckOnError,
+			handler: recordingMiddleware(new([]string), "mw")(
+				cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return errFailed }),
+			),
+			expected: conetest.Nak,
+		},
+		{
+			name:     "No error is acked",
+			mode:     cone.AutoAckOnError,
+			handler:  cone.ErrHandlerFunc(func(_ cone.Response, _ *cone.Event) error { return nil }),
+			expected: conetest.Ack,
+		},
+		{
+			name: "Error after responding is ignored",
+			mode: cone.AutoAckOnError,
+			handler: cone.ErrHandlerFunc(func(r cone.Response, _ *cone.Event) error {
+				_ = cone.Term(r)
+				return errFailed
+			}),
+			expected: conetest.Term,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cone.NewHandlerMux()
+			c.AutoAck = tt.mode
+			c.Handle("event.subject", tt.handler)
+
+			r := conetest.NewRecorder()
+			c.Serve(r, conetest.NewEvent("event.subject", nil))
+			if r.Result() != tt.expected {
+				t.Fatalf("Expected '%s' but got: '%s'", tt.expected, r.Result())
+			}
+			if r.NumResponses() > 1 {
+				t.Fatalf("Expected at most one response but got %d", r.NumResponses())
+			}
+		})
+	}
+
+	t.Run("Response without state is tracked", func(t *testing.T) {
+		c := cone.NewHandlerMux()
+		c.HandleFunc("event.subject", func(r cone.Response, _ *cone.Event) { _ = r.Nak() })
+
+		r := &ackNakResponse{}
+		c.Serve(r, conetest.NewEvent("event.subject", nil))
+		if r.result != conetest.Nak {
+			t.Fatalf("Expected %s but got: %s", conetest.Nak, r.result)
+		}
+	})
+}
+
+func TestWildcardSubjects(t *testing.T) {
+	var called string
+	handler := func(name string) cone.HandlerFunc {
+		return func(_ cone.Response, _ *cone.Event) { called = name }
+	}
+
+	c := cone.NewHandlerMux()
+	c.HandleFunc("orders.>", handler("orders.>"))
+	c.HandleFunc("orders.*", handler("orders.*"))
+	c.HandleFunc("orders.*.v1", handler("orders.*.v1"))
+	c.HandleFunc("orders.created", handler("orders.created"))
+
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{"orders.created", "orders.created"},
+		{"orders.deleted", "orders.*"},
+		{"orders.deleted.v1", "orders.*.v1"},
+		{"orders.deleted.v2", "orders.>"},
+		{"orders", ""},
+	}
+
+	for _, tt := range tests {
+		called = ""
+		c.Serve(conetest.NewRecorder(), conetest.NewEvent(tt.subject, nil))
+		if called != tt.expected {
+			t.Errorf("%s: Expected %s to handle the event but %s did", tt.subject, tt.expected, called)
+		}
+	}
+}
+
+func TestHandleMatch(t *testing.T) {
+	var called string
+	handler := func(name string) cone.HandlerFunc {
+		return func(_ cone.Response, _ *cone.Event) { called = name }
+	}
+
+	c := cone.NewHandlerMux()
+	c.HandleFunc("orders.created", handler("plain"))
+	c.HandleMatch(cone.Subject("orders.>").Header("type", "created"), handler("type"))
+	c.HandleMatch(cone.Subject("orders.>").Header("type", "created").Header("version", "2"), handler("type+version"))
+	c.HandleMatch(cone.Subject("orders.created").Header("type", "created"), handler("exact type"))
+	c.HandleMatch(cone.Subject("orders.deleted"), handler("no headers"))
+
+	tests := []struct {
+		name     string
+		subject  string
+		headers  map[string]string
+		expected string
+	}{
+		{"Plain route without headers", "orders.created", nil, "plain"},
+		{"Header route beats plain route", "orders.created", map[string]string{"type": "created"}, "exact type"},
+		{"Wildcard header route", "orders.updated", map[string]string{"type": "created"}, "type"},
+		{"Most header predicates win", "orders.created", map[string]string{"type": "created", "version": "2"}, "type+version"},
+		{"Unmatched header value", "orders.updated", map[string]string{"type": "deleted"}, ""},
+		{"Matcher without headers", "orders.deleted", nil, "no headers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = ""
+			e := conetest.NewEvent(tt.subject, nil)
+			for key, value := range tt.headers {
+				e.Header.Set(key, value)
+			}
+			c.Serve(conetest.NewRecorder(), e)
+			if called != tt.expected {
+				t.Fatalf("Expected '%s' to handle the event but '%s' did", tt.expected, called)
+			}
+		})
+	}
+
+	t.Run("Group prefix applies", func(t *testing.T) {
+		c := cone.NewHandlerMux()
+		c.Group("billing", func(g *cone.HandlerMux) {
+			g.HandleMatch(cone.Subject("invoice").Header("type", "paid"), handler("group"))
+		})
+
+		called = ""
+		e := conetest.NewEvent("billing.invoice", nil)
+		e.Header.Set("type", "paid")
+		c.Serve(conetest.NewRecorder(), e)
+		if called != "group" {
+			t.Fatalf("Expected group handler to handle the event but '%s' did", called)
+		}
+	})
+}
+
 // func TestMiddlewareAroundConsumer(t *testing.T) {
 // 	s := conetest.NewSource()
 // 	h := cone.NewHandlerMux()
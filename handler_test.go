@@ -0,0 +1,170 @@
+package cone_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	var deadline time.Time
+	var handler cone.HandlerFunc = func(r cone.Response, e *cone.Event) {
+		deadline, _ = e.Context().Deadline()
+	}
+
+	before := time.Now()
+	cone.TimeoutHandler(handler, time.Minute).Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+	if deadline.Before(before.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("Expected deadline in a minute but got: %s", deadline)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) cone.Middleware {
+		return func(next cone.Handler) cone.Handler {
+			return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+				calls = append(calls, name)
+				next.Serve(r, e)
+			})
+		}
+	}
+	var handler cone.HandlerFunc = func(r cone.Response, e *cone.Event) {
+		calls = append(calls, "handler")
+	}
+
+	cone.Chain(mw("a"), mw("b"), mw("c"))(handler).Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+	expected := []string{"a", "b", "c", "handler"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("Expected calls %v but got %v", expected, calls)
+	}
+}
+
+// ackNakResponse is a Response without Term support.
+type ackNakResponse struct {
+	result string
+}
+
+func (r *ackNakResponse) Ack() error {
+	r.result = conetest.Ack
+	return nil
+}
+
+func (r *ackNakResponse) Nak() error {
+	r.result = conetest.Nak
+	return nil
+}
+
+func TestTerm(t *testing.T) {
+	t.Run("Terminates when supported", func(t *testing.T) {
+		r := conetest.NewRecorder()
+		_ = cone.Term(r)
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected %s but got: %s", conetest.Term, r.Result())
+		}
+	})
+
+	t.Run("Acks when not supported", func(t *testing.T) {
+		r := &ackNakResponse{}
+		_ = cone.Term(r)
+		if r.result != conetest.Ack {
+			t.Fatalf("Expected %s but got: %s", conetest.Ack, r.result)
+		}
+	})
+}
+
+type delayResponse struct {
+	ackNakResponse
+	delay time.Duration
+}
+
+func (r *delayResponse) NakWithDelay(delay time.Duration) error {
+	r.delay = delay
+	return r.Nak()
+}
+
+func TestNakWithDelay(t *testing.T) {
+	t.Run("Delays when supported", func(t *testing.T) {
+		r := conetest.NewRecorder()
+		_ = cone.NakWithDelay(r, time.Second)
+		if r.Result() != conetest.Nak || r.Delay() != time.Second {
+			t.Fatalf("Expected %s with delay 1s but got: %s with %s", conetest.Nak, r.Result(), r.Delay())
+		}
+	})
+
+	t.Run("Naks when not supported", func(t *testing.T) {
+		r := &ackNakResponse{}
+		_ = cone.NakWithDelay(r, time.Second)
+		if r.result != conetest.Nak {
+			t.Fatalf("Expected %s but got: %s", conetest.Nak, r.result)
+		}
+	})
+
+	t.Run("Delay is passed through the mux", func(t *testing.T) {
+		h := cone.NewHandlerMux()
+		h.HandleFunc("event.subject", func(r cone.Response, _ *cone.Event) {
+			_ = cone.NakWithDelay(r, time.Second)
+		})
+
+		r := &delayResponse{}
+		h.Serve(r, conetest.NewEvent("event.subject", nil))
+		if r.result != conetest.Nak || r.delay != time.Second {
+			t.Fatalf("Expected %s with delay 1s but got: %s with %s", conetest.Nak, r.result, r.delay)
+		}
+	})
+}
+
+type deliveryResponse struct {
+	ackNakResponse
+	delivered uint64
+}
+
+func (r *deliveryResponse) NumDelivered() uint64 {
+	return r.delivered
+}
+
+func TestNumDelivered(t *testing.T) {
+	if n := cone.NumDelivered(&deliveryResponse{delivered: 3}); n != 3 {
+		t.Fatalf("Expected 3 deliveries but got %d", n)
+	}
+	if n := cone.NumDelivered(&ackNakResponse{}); n != 0 {
+		t.Fatalf("Expected 0 for unsupported response but got %d", n)
+	}
+}
+
+func TestRecordOutcome(t *testing.T) {
+	t.Run("First response should be recorded", func(t *testing.T) {
+		r := cone.RecordOutcome(conetest.NewRecorder())
+		if r.Outcome() != cone.OutcomeNone {
+			t.Fatalf("Expected %s but got %s", cone.OutcomeNone, r.Outcome())
+		}
+		_ = cone.NakWithDelay(r, time.Second)
+		_ = r.Ack()
+		if r.Outcome() != cone.OutcomeNak {
+			t.Fatalf("Expected %s but got %s", cone.OutcomeNak, r.Outcome())
+		}
+	})
+
+	t.Run("Term without support should be recorded as ack", func(t *testing.T) {
+		r := cone.RecordOutcome(&ackNakResponse{})
+		_ = cone.Term(r)
+		if r.Outcome() != cone.OutcomeAck {
+			t.Fatalf("Expected %s but got %s", cone.OutcomeAck, r.Outcome())
+		}
+	})
+
+	t.Run("Responses made before wrapping should not be recorded", func(t *testing.T) {
+		recorder := conetest.NewRecorder()
+		_ = recorder.Ack()
+		r := cone.RecordOutcome(recorder)
+		_ = r.Nak()
+		if r.Outcome() != cone.OutcomeNone {
+			t.Fatalf("Expected %s but got %s", cone.OutcomeNone, r.Outcome())
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package cone
+
+import (
+	"context"
+	"time"
+)
+
+// StatusSource is implemented by sources that can report on the server they
+// consume from, for Consumer.Health.
+type StatusSource interface {
+	Status(ctx context.Context) (SourceStatus, error)
+}
+
+// SourceStatus is the status of the server a source consumes from.
+type SourceStatus struct {
+	// Connected reports whether the source can reach the server.
+	Connected bool
+
+	// Pending is the number of events waiting on the server to be
+	// delivered to the source.
+	Pending uint64
+}
+
+// Health is a snapshot of what a Consumer is doing, as returned by
+// Consumer.Health.
+type Health struct {
+	State State
+
+	// Started is when the consumer last started running.
+	Started time.Time
+
+	// Paused reports whether the consumer is paused, and Resumed when it was
+	// last resumed.
+	Paused  bool
+	Resumed time.Time
+
+	// Throttled reports whether the Throttle of the consumer is holding it
+	// back from fetching events.
+	Throttled bool
+
+	// LastEvent is when the source last delivered an event, or the zero
+	// time if it has not since the consumer started.
+	LastEvent time.Time
+
+	// InFlight is the number of events being handled, and OldestInFlight
+	// when the consumer started handling the oldest of them.
+	InFlight       int
+	OldestInFlight time.Time
+
+	// Connected reports whether the source is running and, if it is a
+	// StatusSource, connected to the server.
+	Connected bool
+
+	// Pending is the number of events waiting on the server, or -1 if the
+	// source does not report it.
+	Pending int64
+
+	// SourceErr is the error the source reported its status with, if any.
+	SourceErr error
+}
+
+// Stalled reports whether the consumer is running but not making progress.
+// It is stalled if an event has been in flight for longer than timeout, as
+// handlers that do not return eventually keep the server from delivering
+// more events. Otherwise it is stalled if it is not paused or throttled, and
+// has no events in flight, with events pending on the server, but has not
+// been delivered one for longer than timeout.
+func (h Health) Stalled(timeout time.Duration) bool {
+	if h.State != StateRunning {
+		return false
+	}
+	if h.InFlight > 0 {
+		return time.Since(h.OldestInFlight) > timeout
+	}
+	if h.Paused || h.Throttled || h.Pending <= 0 {
+		return false
+	}
+
+	progress := h.Started
+	for _, t := range []time.Time{h.LastEvent, h.Resumed} {
+		if t.After(progress) {
+			progress = t
+		}
+	}
+	return time.Since(progress) > timeout
+}
+
+// Health returns the health of the consumer. If the source is a StatusSource
+// its status is requested with ctx.
+func (c *Consumer) Health(ctx context.Context) Health {
+	c.mu.Lock()
+	h := Health{
+		State:     c.state,
+		Started:   c.started,
+		Paused:    c.resumed != nil,
+		Resumed:   c.resumedAt,
+		Connected: c.sourceRunning,
+		Pending:   -1,
+	}
+	c.mu.Unlock()
+
+	h.InFlight, h.OldestInFlight = c.inFlight.oldest()
+
+	if c.Throttle != nil {
+		h.Throttled = c.Throttle.Delay() > 0
+	}
+
+	if last := c.lastEvent.Load(); last != 0 {
+		h.LastEvent = time.Unix(0, last)
+	}
+
+	source, ok := c.source.(StatusSource)
+	if !ok || !h.Connected {
+		return h
+	}
+
+	status, err := source.Status(ctx)
+	if err != nil {
+		h.Connected = false
+		h.SourceErr = err
+		return h
+	}
+	h.Connected = status.Connected
+	h.Pending = int64(status.Pending)
+
+	return h
+}
@@ -0,0 +1,185 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+const (
+	// DefaultStallTimeout is how long a consumer may go without being
+	// delivered an event, while events are pending, or take to handle an
+	// event, before it is stalled.
+	DefaultStallTimeout = time.Minute
+
+	// DefaultCheckTimeout bounds how long checking the sources takes.
+	DefaultCheckTimeout = 5 * time.Second
+)
+
+// Statuses of a Report.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Report is the result of a check, as served as JSON by Handler.
+type Report struct {
+	Status    string                    `json:"status"`
+	Consumers map[string]ConsumerReport `json:"consumers"`
+}
+
+// ConsumerReport is the health of a single consumer.
+type ConsumerReport struct {
+	State     string     `json:"state"`
+	Started   *time.Time `json:"started,omitempty"`
+	LastEvent *time.Time `json:"last_event,omitempty"`
+	InFlight  int        `json:"in_flight"`
+	Connected bool       `json:"connected"`
+	Pending   *int64     `json:"pending,omitempty"`
+	Stalled   bool       `json:"stalled"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Handler serves liveness checks on paths ending in /healthz, and readiness
+// checks on paths ending in /readyz, for the consumers added to it.
+//
+// A consumer is live unless it has stopped or stalled. It is ready if it is
+// running, its source is connected and it has not stalled. A consumer is
+// stalled if it has been handling an event for longer than StallTimeout, or
+// if events are pending on the server, but the source has not delivered one
+// for longer than StallTimeout, see cone.Health.Stalled. Checks pass with status 200
+// if every consumer passes, and fail with 503 otherwise.
+type Handler struct {
+	// StallTimeout, if non-zero, replaces DefaultStallTimeout.
+	StallTimeout time.Duration
+
+	// CheckTimeout, if non-zero, replaces DefaultCheckTimeout.
+	CheckTimeout time.Duration
+
+	mu        sync.Mutex
+	names     []string
+	consumers map[string]*cone.Consumer
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// Add adds a consumer to the checks, reported under name. It panics if name
+// is empty or already added.
+func (h *Handler) Add(name string, c *cone.Consumer) {
+	if name == "" {
+		panic("empty consumer name is not allowed")
+	}
+	if c == nil {
+		panic("nil consumer is not allowed")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.consumers[name]; ok {
+		panic("consumer " + name + " is already added")
+	}
+	if h.consumers == nil {
+		h.consumers = make(map[string]*cone.Consumer)
+	}
+	h.consumers[name] = c
+	h.names = append(h.names, name)
+	slices.Sort(h.names)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var report Report
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/healthz"):
+		report = h.Live(r.Context())
+	case strings.HasSuffix(r.URL.Path, "/readyz"):
+		report = h.Ready(r.Context())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Live checks whether the consumers are live.
+func (h *Handler) Live(ctx context.Context) Report {
+	return h.check(ctx, func(health cone.Health, stalled bool) bool {
+		return health.State != cone.StateStopped && !stalled
+	})
+}
+
+// Ready checks whether the consumers are ready.
+func (h *Handler) Ready(ctx context.Context) Report {
+	return h.check(ctx, func(health cone.Health, stalled bool) bool {
+		return health.State == cone.StateRunning && health.Connected && !stalled
+	})
+}
+
+func (h *Handler) check(ctx context.Context, pass func(health cone.Health, stalled bool) bool) Report {
+	timeout := h.CheckTimeout
+	if timeout == 0 {
+		timeout = DefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stallTimeout := h.StallTimeout
+	if stallTimeout == 0 {
+		stallTimeout = DefaultStallTimeout
+	}
+
+	h.mu.Lock()
+	names := slices.Clone(h.names)
+	consumers := make([]*cone.Consumer, len(names))
+	for i, name := range names {
+		consumers[i] = h.consumers[name]
+	}
+	h.mu.Unlock()
+
+	report := Report{Status: StatusOK, Consumers: make(map[string]ConsumerReport, len(names))}
+	for i, name := range names {
+		health := consumers[i].Health(ctx)
+		stalled := health.Stalled(stallTimeout)
+		if !pass(health, stalled) {
+			report.Status = StatusUnavailable
+		}
+		report.Consumers[name] = newConsumerReport(health, stalled)
+	}
+
+	return report
+}
+
+func newConsumerReport(health cone.Health, stalled bool) ConsumerReport {
+	r := ConsumerReport{
+		State:     health.State.String(),
+		InFlight:  health.InFlight,
+		Connected: health.Connected,
+		Stalled:   stalled,
+	}
+	if !health.Started.IsZero() {
+		r.Started = &health.Started
+	}
+	if !health.LastEvent.IsZero() {
+		r.LastEvent = &health.LastEvent
+	}
+	if health.Pending >= 0 {
+		r.Pending = &health.Pending
+	}
+	if health.SourceErr != nil {
+		r.Error = health.SourceErr.Error()
+	}
+	return r
+}
@@ -0,0 +1,163 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/health"
+)
+
+type statusSource struct {
+	*conetest.Source
+	pending uint64
+}
+
+func (s *statusSource) Status(context.Context) (cone.SourceStatus, error) {
+	return cone.SourceStatus{Connected: true, Pending: s.pending}, nil
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("Running consumers should be live and ready", func(t *testing.T) {
+		h := health.NewHandler()
+		for _, name := range []string{"orders", "payments"} {
+			c := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+			h.Add(name, c)
+			run(t, c)
+		}
+
+		for _, path := range []string{"/healthz", "/readyz"} {
+			code, report := get(t, h, path)
+			if code != http.StatusOK {
+				t.Fatalf("Expected %s to return 200 but got %d", path, code)
+			}
+			if report.Status != health.StatusOK || len(report.Consumers) != 2 {
+				t.Fatalf("Expected ok for 2 consumers but got %s for %d", report.Status, len(report.Consumers))
+			}
+			if report.Consumers["orders"].State != "running" {
+				t.Fatalf("Expected running but got %s", report.Consumers["orders"].State)
+			}
+		}
+	})
+
+	t.Run("Idle consumer should be live but not ready", func(t *testing.T) {
+		h := health.NewHandler()
+		h.Add("orders", cone.New(conetest.NewSource(), cone.NewHandlerMux()))
+
+		if code, _ := get(t, h, "/healthz"); code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d", code)
+		}
+		code, report := get(t, h, "/readyz")
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503 but got %d", code)
+		}
+		if report.Status != health.StatusUnavailable {
+			t.Fatalf("Expected unavailable but got %s", report.Status)
+		}
+	})
+
+	t.Run("Stalled consumer should not be live", func(t *testing.T) {
+		h := health.NewHandler()
+		h.StallTimeout = time.Millisecond
+
+		c := cone.New(&statusSource{Source: conetest.NewSource(), pending: 5}, cone.NewHandlerMux())
+		h.Add("orders", c)
+		run(t, c)
+		time.Sleep(5 * time.Millisecond)
+
+		code, report := get(t, h, "/healthz")
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503 but got %d", code)
+		}
+		orders := report.Consumers["orders"]
+		if !orders.Stalled {
+			t.Fatal("Expected consumer to be stalled")
+		}
+		if orders.Pending == nil || *orders.Pending != 5 {
+			t.Fatalf("Expected 5 pending but got %v", orders.Pending)
+		}
+	})
+
+	t.Run("Consumer with a hung handler should not be live", func(t *testing.T) {
+		h := health.NewHandler()
+		h.StallTimeout = 50 * time.Millisecond
+
+		handling := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		source := &statusSource{Source: conetest.NewSource(), pending: 5}
+		c := cone.New(source, cone.HandlerFunc(func(r cone.Response, _ *cone.Event) {
+			close(handling)
+			<-release
+			_ = r.Ack()
+		}))
+		h.Add("orders", c)
+		run(t, c)
+		source.AddEvent(conetest.NewEvent("orders.created", nil))
+		<-handling
+
+		if code, report := get(t, h, "/healthz"); code != http.StatusOK || report.Consumers["orders"].InFlight != 1 {
+			t.Fatalf("Expected 200 with 1 event in flight but got %d with %+v", code, report.Consumers["orders"])
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		code, report := get(t, h, "/healthz")
+		if code != http.StatusServiceUnavailable || !report.Consumers["orders"].Stalled {
+			t.Fatalf("Expected 503 with the consumer stalled but got %d with %+v", code, report.Consumers["orders"])
+		}
+	})
+
+	t.Run("Unknown path should not be found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		health.NewHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404 but got %d", rec.Code)
+		}
+	})
+
+	t.Run("Adding a name twice should panic", func(t *testing.T) {
+		h := health.NewHandler()
+		h.Add("orders", cone.New(conetest.NewSource(), cone.NewHandlerMux()))
+
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected panic but got none")
+			}
+		}()
+		h.Add("orders", cone.New(conetest.NewSource(), cone.NewHandlerMux()))
+	})
+}
+
+func run(t *testing.T, c *cone.Consumer) {
+	t.Helper()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = c.ListenAndConsume()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	t.Cleanup(func() {
+		_ = c.Close()
+		<-stopped
+	})
+}
+
+func get(t *testing.T, h http.Handler, path string) (int, health.Report) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Expected nil but got err: %s", err.Error())
+	}
+	return rec.Code, report
+}
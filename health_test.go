@@ -0,0 +1,132 @@
+package cone_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+type statusSource struct {
+	*conetest.Source
+	status cone.SourceStatus
+	err    error
+}
+
+func (s *statusSource) Status(context.Context) (cone.SourceStatus, error) {
+	return s.status, s.err
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("Idle consumer", func(t *testing.T) {
+		c := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+		health := c.Health(context.Background())
+		if health.State != cone.StateIdle {
+			t.Fatalf("Expected state idle but got %s", health.State)
+		}
+		if health.Connected {
+			t.Fatal("Expected source to not be connected")
+		}
+		if health.Pending != -1 {
+			t.Fatalf("Expected unknown pending but got %d", health.Pending)
+		}
+	})
+
+	t.Run("Running consumer", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		block := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			<-block
+			_ = r.Ack()
+		}
+		c := cone.New(s, handler)
+
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+
+		health := c.Health(context.Background())
+		if health.State != cone.StateRunning {
+			t.Fatalf("Expected state running but got %s", health.State)
+		}
+		if !health.Connected {
+			t.Fatal("Expected source to be connected")
+		}
+		if health.InFlight != 1 {
+			t.Fatalf("Expected 1 event in flight but got %d", health.InFlight)
+		}
+		if health.LastEvent.IsZero() || health.LastEvent.Before(health.Started) {
+			t.Fatalf("Expected last event after start but got %s", health.LastEvent)
+		}
+
+		close(block)
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		health = c.Health(context.Background())
+		if health.InFlight != 0 {
+			t.Fatalf("Expected no events in flight but got %d", health.InFlight)
+		}
+		if health.Connected {
+			t.Fatal("Expected source to not be connected")
+		}
+	})
+
+	t.Run("Status source", func(t *testing.T) {
+		s := &statusSource{Source: conetest.NewSource(), status: cone.SourceStatus{Connected: true, Pending: 3}}
+		c := cone.New(s, cone.NewHandlerMux())
+
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+
+		health := c.Health(context.Background())
+		if !health.Connected || health.Pending != 3 {
+			t.Fatalf("Expected connected with 3 pending but got %t with %d", health.Connected, health.Pending)
+		}
+
+		s.err = errors.New("disconnected")
+		health = c.Health(context.Background())
+		if health.Connected || health.SourceErr == nil {
+			t.Fatalf("Expected disconnected with error but got %t with %v", health.Connected, health.SourceErr)
+		}
+
+		if err := c.Close(); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+	})
+}
+
+func TestHealthStalled(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		health   cone.Health
+		expected bool
+	}{
+		{"No pending events", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour)}, false},
+		{"Unknown pending events", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), Pending: -1}, false},
+		{"Recently started", cone.Health{State: cone.StateRunning, Started: now, Pending: 1}, false},
+		{"Recent event", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), LastEvent: now, Pending: 1}, false},
+		{"No recent event", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), LastEvent: now.Add(-time.Hour), Pending: 1}, true},
+		{"Throttled", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), Pending: 1, Throttled: true}, false},
+		{"Paused", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), Pending: 1, Paused: true}, false},
+		{"Recent event in flight", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), LastEvent: now.Add(-time.Hour), Pending: 1, InFlight: 1, OldestInFlight: now}, false},
+		{"Old event in flight", cone.Health{State: cone.StateRunning, Started: now.Add(-time.Hour), LastEvent: now.Add(-time.Hour), InFlight: 1, OldestInFlight: now.Add(-time.Hour)}, true},
+		{"Not running", cone.Health{State: cone.StateRestarting, Started: now.Add(-time.Hour), Pending: 1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if stalled := test.health.Stalled(time.Minute); stalled != test.expected {
+				t.Fatalf("Expected stalled to be %t but got %t", test.expected, stalled)
+			}
+		})
+	}
+}
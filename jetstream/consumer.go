@@ -0,0 +1,84 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+)
+
+var (
+	ErrSubjectNotInStream = errors.New("subject not in stream")
+)
+
+// CreateOrUpdateConsumer creates or updates the durable consumer described by
+// cfg on stream, filtering on the subjects registered on mux. It fails if a
+// registered subject is not part of the stream, if the mux has no routes, or
+// with cone.ErrOverlappingSubjects if its subjects overlap. Subjects are
+// checked before the server is called.
+func CreateOrUpdateConsumer(
+	ctx context.Context,
+	js jetstream.JetStream,
+	stream string,
+	cfg jetstream.ConsumerConfig,
+	mux *cone.HandlerMux,
+) (jetstream.Consumer, error) {
+	if cfg.Durable == "" {
+		return nil, fmt.Errorf("consumer config is missing a durable name")
+	}
+
+	subjects, err := cone.FilterSubjects(mux.Routes())
+	if err != nil {
+		return nil, err
+	}
+	if len(subjects) == 0 {
+		return nil, fmt.Errorf("mux has no routes")
+	}
+
+	s, err := js.Stream(ctx, stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %s: %w", stream, err)
+	}
+
+	info, err := s.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %s info: %w", stream, err)
+	}
+
+	if err := checkStreamCovers(stream, info.Config.Subjects, subjects); err != nil {
+		return nil, err
+	}
+
+	cfg.FilterSubject = ""
+	cfg.FilterSubjects = subjects
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create or update consumer %s: %w", cfg.Durable, err)
+	}
+
+	return consumer, nil
+}
+
+// checkStreamCovers returns an error listing the subjects that are not part
+// of a stream with the given subjects.
+func checkStreamCovers(stream string, streamSubjects, subjects []string) error {
+	var missing []string
+	for _, subject := range subjects {
+		covered := slices.ContainsFunc(streamSubjects, func(streamSubject string) bool {
+			return cone.SubjectCovers(streamSubject, subject)
+		})
+		if !covered {
+			missing = append(missing, subject)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w %s: %s", ErrSubjectNotInStream, stream, strings.Join(missing, ", "))
+	}
+	return nil
+}
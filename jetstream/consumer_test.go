@@ -0,0 +1,76 @@
+package jetstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+	conejetstream "github.com/zapling/cone/jetstream"
+)
+
+func TestCreateOrUpdateConsumer(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	_ = getNatsConsumer(t, nc) // Sets up the stream
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+
+	handler := func(_ cone.Response, _ *cone.Event) {}
+	cfg := jetstream.ConsumerConfig{Durable: "jetstream-mux-consumer"}
+
+	t.Run("Filters on registered subjects", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("test_event", handler)
+		mux.HandleFunc("other_event", handler)
+
+		consumer, err := conejetstream.CreateOrUpdateConsumer(context.Background(), js, "jetstream-test", cfg, mux)
+		if err != nil {
+			t.Fatalf("Failed to create consumer: %s", err.Error())
+		}
+
+		expected := []string{"other_event", "test_event"}
+		if fmt.Sprint(consumer.CachedInfo().Config.FilterSubjects) != fmt.Sprint(expected) {
+			t.Fatalf("Expected filter subjects %v but got %v", expected, consumer.CachedInfo().Config.FilterSubjects)
+		}
+	})
+
+	t.Run("Subject outside of stream should error", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("test_event", handler)
+		mux.HandleFunc("orders.created", handler)
+
+		_, err := conejetstream.CreateOrUpdateConsumer(context.Background(), js, "jetstream-test", cfg, mux)
+		if !errors.Is(err, conejetstream.ErrSubjectNotInStream) {
+			t.Fatalf("Expected ErrSubjectNotInStream but got: %v", err)
+		}
+	})
+
+	t.Run("Overlapping subjects should error before creating the consumer", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("orders.*.created", handler)
+		mux.HandleFunc("orders.eu.>", handler)
+
+		cfg := jetstream.ConsumerConfig{Durable: "jetstream-overlap-consumer"}
+		_, err := conejetstream.CreateOrUpdateConsumer(context.Background(), js, "jetstream-test", cfg, mux)
+		if !errors.Is(err, cone.ErrOverlappingSubjects) {
+			t.Fatalf("Expected ErrOverlappingSubjects but got: %v", err)
+		}
+
+		_, err = js.Consumer(context.Background(), "jetstream-test", cfg.Durable)
+		if !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			t.Fatalf("Expected consumer not to be created but got: %v", err)
+		}
+	})
+
+	t.Run("Mux without routes should error", func(t *testing.T) {
+		_, err := conejetstream.CreateOrUpdateConsumer(context.Background(), js, "jetstream-test", cfg, cone.NewHandlerMux())
+		if err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+	})
+}
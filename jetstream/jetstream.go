@@ -2,22 +2,33 @@ package jetstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/zapling/cone"
 )
 
 var (
-	_ cone.Source   = &Source{}
-	_ cone.Response = &responseAndEvent{}
-	_ Response      = &responseAndEvent{}
+	_ cone.Source           = &Source{}
+	_ cone.StatusSource     = &Source{}
+	_ cone.PausableSource   = &Source{}
+	_ cone.Response         = &responseAndEvent{}
+	_ cone.TermResponse     = &responseAndEvent{}
+	_ cone.DelayResponse    = &responseAndEvent{}
+	_ cone.ResponseState    = &responseAndEvent{}
+	_ cone.DeliveryResponse = &responseAndEvent{}
+	_ Response              = &responseAndEvent{}
 )
 
 type Response interface {
 	cone.Response
 	NakWithDelay(delay time.Duration) error
+	Term() error
 }
 
 func New(consumer jetstream.Consumer, opts ...jetstream.PullConsumeOpt) *Source {
@@ -25,55 +36,147 @@ func New(consumer jetstream.Consumer, opts ...jetstream.PullConsumeOpt) *Source
 }
 
 type Source struct {
-	consumer       jetstream.Consumer
-	consumeContext jetstream.ConsumeContext
-	opts           []jetstream.PullConsumeOpt
+	consumer jetstream.Consumer
+	opts     []jetstream.PullConsumeOpt
 
+	mu                sync.Mutex
+	running           bool
+	consumeContext    jetstream.ConsumeContext // nil while paused
 	responseAndEvents chan *responseAndEvent
+	errs              chan error
+	stopped           chan struct{}
 }
 
 func (s *Source) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return fmt.Errorf("is already running")
+	}
+
 	s.responseAndEvents = make(chan *responseAndEvent)
-	consumeContext, err := s.consumer.Consume(s.messageHandler(), s.opts...)
+	s.errs = make(chan error, 1)
+
+	if err := s.consume(); err != nil {
+		return classify(fmt.Errorf("failed to start: %w", err))
+	}
+	s.running = true
+
+	return nil
+}
+
+// consume starts fetching messages from the server. s.mu must be held.
+func (s *Source) consume() error {
+	stopped := make(chan struct{})
+	opts := append(s.opts[:len(s.opts):len(s.opts)], jetstream.ConsumeErrHandler(s.errHandler(s.errs)))
+	consumeContext, err := s.consumer.Consume(s.messageHandler(s.responseAndEvents, stopped), opts...)
 	if err != nil {
-		return fmt.Errorf("failed to start: %w", err)
+		return err
 	}
 
 	s.consumeContext = consumeContext
-
+	s.stopped = stopped
 	return nil
 }
 
+// Stop stops fetching messages from the server. Messages that have already
+// been fetched but not handed out by Next are Nak'd so they are redelivered.
 func (s *Source) Stop(ctx context.Context) error {
-	if s.consumeContext == nil {
+	s.mu.Lock()
+	running := s.running
+	s.running = false
+	consumeContext := s.consumeContext
+	s.consumeContext = nil
+	if consumeContext != nil {
+		close(s.stopped)
+	}
+	s.mu.Unlock()
+
+	if !running {
 		return fmt.Errorf("is not running")
 	}
+	if consumeContext == nil {
+		return nil // Paused
+	}
 
-	s.consumeContext.Drain()
+	consumeContext.Drain()
 
 	select {
-	case <-s.consumeContext.Closed():
-		s.consumeContext.Stop()
+	case <-consumeContext.Closed():
+		consumeContext.Stop()
 	case <-ctx.Done():
-		s.consumeContext.Stop()
+		consumeContext.Stop()
 	}
 
+	return nil
+}
+
+// Pause stops fetching messages from the server until Resume is called.
+// Messages that have already been fetched but not handed out by Next are
+// Nak'd so they are redelivered.
+func (s *Source) Pause() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return fmt.Errorf("is not running")
+	}
+	if s.consumeContext == nil {
+		return nil
+	}
+
+	close(s.stopped)
+	s.consumeContext.Drain()
 	s.consumeContext = nil
-	close(s.responseAndEvents)
 
 	return nil
 }
 
+// Resume continues fetching messages from the server after Pause.
+func (s *Source) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return fmt.Errorf("is not running")
+	}
+	if s.consumeContext != nil {
+		return nil
+	}
+
+	if err := s.consume(); err != nil {
+		return classify(fmt.Errorf("failed to resume: %w", err))
+	}
+	return nil
+}
+
 func (s *Source) Next() (cone.Response, *cone.Event, error) {
+	s.mu.Lock()
+	responseAndEvents, errs := s.responseAndEvents, s.errs
+	s.mu.Unlock()
+
 	select {
-	case responseEvent := <-s.responseAndEvents:
+	case responseEvent := <-responseAndEvents:
 		return responseEvent, responseEvent.Event, nil
+	case err := <-errs:
+		return nil, nil, err
 	case <-time.After(10 * time.Millisecond):
 		return nil, nil, nil
 	}
 }
 
-func (s *Source) messageHandler() func(jetstream.Msg) {
+// Status reports the number of messages pending on the consumer. The source
+// is connected if the consumer info could be fetched from the server.
+func (s *Source) Status(ctx context.Context) (cone.SourceStatus, error) {
+	info, err := s.consumer.Info(ctx)
+	if err != nil {
+		return cone.SourceStatus{}, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	return cone.SourceStatus{Connected: true, Pending: info.NumPending}, nil
+}
+
+func (s *Source) messageHandler(responseAndEvents chan<- *responseAndEvent, stopped <-chan struct{}) func(jetstream.Msg) {
 	return func(m jetstream.Msg) {
 		event, err := cone.NewEvent(m.Subject(), m.Data())
 		if err != nil {
@@ -82,36 +185,98 @@ func (s *Source) messageHandler() func(jetstream.Msg) {
 			return
 		}
 		event.Header = cone.Header(m.Headers())
-		s.responseAndEvents <- &responseAndEvent{Event: event, m: m}
+
+		select {
+		case responseAndEvents <- &responseAndEvent{Event: event, m: m}:
+		case <-stopped:
+			_ = m.Nak()
+		}
+	}
+}
+
+// errHandler forwards errors that made the server stop delivering messages to
+// Next. A deleted consumer only shows up as missing heartbeats, which nats.go
+// otherwise recovers from, so those trigger a check that it still exists.
+func (s *Source) errHandler(errs chan error) jetstream.ConsumeErrHandlerFunc {
+	return func(_ jetstream.ConsumeContext, err error) {
+		switch {
+		case errors.Is(err, jetstream.ErrConsumerDeleted), errors.Is(err, jetstream.ErrBadRequest):
+			sendErr(errs, classify(fmt.Errorf("consume stopped: %w", err)))
+		case errors.Is(err, jetstream.ErrNoHeartbeat):
+			// The handler is called with nats.go's locks held, do not block
+			go s.checkConsumer(errs)
+		}
+	}
+}
+
+func (s *Source) checkConsumer(errs chan error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.consumer.Info(ctx)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		sendErr(errs, classify(fmt.Errorf("consume stopped: %w", err)))
 	}
 }
 
+func sendErr(errs chan error, err error) {
+	select {
+	case errs <- err:
+	default: // An error is already pending
+	}
+}
+
+// classify marks err as transient unless the connection to the server has
+// been closed for good.
+func classify(err error) error {
+	if errors.Is(err, nats.ErrConnectionClosed) {
+		return err
+	}
+	return cone.Transient(err)
+}
+
 type responseAndEvent struct {
 	*cone.Event
 	m            jetstream.Msg
-	responseSent bool
+	responseSent atomic.Bool
 }
 
 func (e *responseAndEvent) Ack() error {
-	if e.responseSent {
+	if e.responseSent.Swap(true) {
 		return nil
 	}
-	e.responseSent = true
 	return e.m.Ack()
 }
 
 func (e *responseAndEvent) Nak() error {
-	if e.responseSent {
+	if e.responseSent.Swap(true) {
 		return nil
 	}
-	e.responseSent = true
 	return e.m.Nak()
 }
 
 func (e *responseAndEvent) NakWithDelay(delay time.Duration) error {
-	if e.responseSent {
+	if e.responseSent.Swap(true) {
 		return nil
 	}
-	e.responseSent = true
 	return e.m.NakWithDelay(delay)
 }
+
+func (e *responseAndEvent) Term() error {
+	if e.responseSent.Swap(true) {
+		return nil
+	}
+	return e.m.Term()
+}
+
+func (e *responseAndEvent) Responded() bool {
+	return e.responseSent.Load()
+}
+
+func (e *responseAndEvent) NumDelivered() uint64 {
+	metadata, err := e.m.Metadata()
+	if err != nil {
+		return 0
+	}
+	return metadata.NumDelivered
+}
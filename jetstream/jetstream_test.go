@@ -2,11 +2,15 @@ package jetstream_test
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
 	conejetstream "github.com/zapling/cone/jetstream"
+	"github.com/zapling/cone/ratelimit"
 )
 
 func TestNew(t *testing.T) {
@@ -40,6 +44,51 @@ func TestStartAndStop(t *testing.T) {
 	})
 }
 
+func TestStopWithPendingMessages(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+	consumer := getNatsConsumer(t, nc)
+	source := conejetstream.New(consumer)
+
+	for i := 0; i < 10; i++ {
+		_, err := js.PublishMsg(context.Background(), &nats.Msg{Subject: "test_event"})
+		if err != nil {
+			t.Fatalf("Failed to publish msg: %s", err.Error())
+		}
+	}
+
+	// Start and stop twice, leaving messages buffered in the source
+	for i := 0; i < 2; i++ {
+		if err := source.Start(); err != nil {
+			t.Fatalf("Failed to start consumer: %s", err.Error())
+		}
+
+		response, _, err := source.Next()
+		if err != nil {
+			t.Fatalf("Failed to get next event: %s", err.Error())
+		}
+		if response == nil {
+			t.Fatal("Expected response but got nil")
+		}
+		_ = response.Ack()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = source.Stop(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Failed to stop consumer: %s", err.Error())
+		}
+	}
+
+	if err := source.Stop(context.Background()); err == nil {
+		t.Fatal("Expected error stopping a stopped source")
+	}
+}
+
 func TestGetNextEvent(t *testing.T) {
 	nc := getNatsConn(t)
 	defer nc.Drain()
@@ -96,6 +145,10 @@ func TestGetNextEvent(t *testing.T) {
 		if event.Subject != "test_event" {
 			t.Fatalf("Got unexpected event: %s", event.Subject)
 		}
+
+		if delivered := cone.NumDelivered(response); delivered != 1 {
+			t.Fatalf("Expected first delivery but got %d", delivered)
+		}
 	})
 
 	t.Run("Event subject", func(t *testing.T) {
@@ -103,6 +156,227 @@ func TestGetNextEvent(t *testing.T) {
 	})
 }
 
+func TestConsumerDeleted(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+	consumer := getNatsConsumer(t, nc)
+	source := conejetstream.New(consumer, jetstream.PullExpiry(time.Second))
+	err = source.Start()
+	if err != nil {
+		t.Fatalf("Failed to start consumer: %s", err.Error())
+	}
+	defer source.Stop(context.Background())
+
+	err = js.DeleteConsumer(context.Background(), "jetstream-test", "jetstream-consumer")
+	if err != nil {
+		t.Fatalf("Failed to delete consumer: %s", err.Error())
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		_, _, err = source.Next()
+		if err != nil {
+			break
+		}
+	}
+
+	if !cone.IsTransient(err) {
+		t.Fatalf("Expected transient error but got: %v", err)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+	consumer := getNatsConsumer(t, nc)
+	source := conejetstream.New(consumer)
+
+	if err := source.Pause(); err == nil {
+		t.Fatal("Expected error pausing a stopped source")
+	}
+
+	if err := source.Start(); err != nil {
+		t.Fatalf("Failed to start consumer: %s", err.Error())
+	}
+	defer source.Stop(context.Background())
+
+	if err := source.Pause(); err != nil {
+		t.Fatalf("Failed to pause consumer: %s", err.Error())
+	}
+
+	_, err = js.PublishMsg(context.Background(), &nats.Msg{Subject: "test_event"})
+	if err != nil {
+		t.Fatalf("Failed to publish msg: %s", err.Error())
+	}
+
+	t.Run("Paused", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			response, _, err := source.Next()
+			if err != nil {
+				t.Fatalf("Failed to get next event: %s", err.Error())
+			}
+			if response != nil {
+				t.Fatal("Expected no event while paused")
+			}
+		}
+	})
+
+	t.Run("Resumed", func(t *testing.T) {
+		if err := source.Resume(); err != nil {
+			t.Fatalf("Failed to resume consumer: %s", err.Error())
+		}
+
+		var response cone.Response
+		deadline := time.Now().Add(5 * time.Second)
+		for response == nil && time.Now().Before(deadline) {
+			response, _, err = source.Next()
+			if err != nil {
+				t.Fatalf("Failed to get next event: %s", err.Error())
+			}
+		}
+		if response == nil {
+			t.Fatal("Expected event after resume")
+		}
+		_ = response.Ack()
+	})
+
+	t.Run("Stop while paused", func(t *testing.T) {
+		if err := source.Pause(); err != nil {
+			t.Fatalf("Failed to pause consumer: %s", err.Error())
+		}
+		if err := source.Stop(context.Background()); err != nil {
+			t.Fatalf("Failed to stop consumer: %s", err.Error())
+		}
+		if err := source.Start(); err != nil {
+			t.Fatalf("Failed to start consumer: %s", err.Error())
+		}
+	})
+}
+
+func TestThrottled(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+	consumer := getNatsConsumer(t, nc)
+
+	publish := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			_, err := js.PublishMsg(context.Background(), &nats.Msg{Subject: "test_event"})
+			if err != nil {
+				t.Fatalf("Failed to publish msg: %s", err.Error())
+			}
+		}
+	}
+	publish(3)
+
+	l := ratelimit.NewLimiter()
+	l.Global = &ratelimit.Limit{Rate: 2}
+	l.Wait = true
+
+	var handled atomic.Int32
+	c := cone.New(conejetstream.New(consumer), l.Middleware(cone.HandlerFunc(func(r cone.Response, _ *cone.Event) {
+		handled.Add(1)
+		_ = r.Ack()
+	})))
+	c.Throttle = l
+	c.ThrottlePause = 100 * time.Millisecond
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = c.ListenAndConsume()
+	}()
+	defer func() {
+		_ = c.Close()
+		<-stopped
+	}()
+
+	t.Run("No deliveries while throttled", func(t *testing.T) {
+		// The first event is handled, the second waits for the limit and the
+		// third is returned to the server when the source is paused
+		time.Sleep(150 * time.Millisecond)
+		info, err := consumer.Info(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to get consumer info: %s", err.Error())
+		}
+		delivered := info.Delivered.Consumer
+
+		publish(2)
+		time.Sleep(250 * time.Millisecond)
+		info, err = consumer.Info(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to get consumer info: %s", err.Error())
+		}
+		if info.Delivered.Consumer != delivered {
+			t.Fatalf("Expected no messages to be delivered while throttled but got %d", info.Delivered.Consumer-delivered)
+		}
+	})
+
+	t.Run("Fetched messages are redelivered", func(t *testing.T) {
+		deadline := time.Now().Add(5 * time.Second)
+		for handled.Load() < 5 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := handled.Load(); n != 5 {
+			t.Fatalf("Expected 5 handled events but got %d", n)
+		}
+	})
+}
+
+func TestStatus(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+	consumer := getNatsConsumer(t, nc)
+	source := conejetstream.New(consumer)
+
+	for i := 0; i < 3; i++ {
+		_, err := js.PublishMsg(context.Background(), &nats.Msg{Subject: "test_event"})
+		if err != nil {
+			t.Fatalf("Failed to publish msg: %s", err.Error())
+		}
+	}
+
+	t.Run("Pending messages", func(t *testing.T) {
+		status, err := source.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		if !status.Connected {
+			t.Fatal("Expected source to be connected")
+		}
+		if status.Pending != 3 {
+			t.Fatalf("Expected 3 pending messages but got %d", status.Pending)
+		}
+	})
+
+	t.Run("Deleted consumer", func(t *testing.T) {
+		err := js.DeleteConsumer(context.Background(), "jetstream-test", "jetstream-consumer")
+		if err != nil {
+			t.Fatalf("Failed to delete consumer: %s", err.Error())
+		}
+
+		if _, err := source.Status(context.Background()); err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+	})
+}
+
 func getNatsConn(t *testing.T) *nats.Conn {
 	t.Helper()
 	nc, err := nats.Connect("localhost:4222")
@@ -0,0 +1,36 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+)
+
+var _ cone.Publisher = &Publisher{}
+
+func NewPublisher(js jetstream.JetStream, opts ...jetstream.PublishOpt) *Publisher {
+	return &Publisher{js: js, opts: opts}
+}
+
+// Publisher publishes events to JetStream, waiting for the server to
+// acknowledge them.
+type Publisher struct {
+	js   jetstream.JetStream
+	opts []jetstream.PublishOpt
+}
+
+func (p *Publisher) Publish(ctx context.Context, e *cone.Event) error {
+	msg := &nats.Msg{
+		Subject: e.Subject,
+		Data:    e.Body,
+		Header:  nats.Header(e.Header),
+	}
+
+	if _, err := p.js.PublishMsg(ctx, msg, p.opts...); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", e.Subject, err)
+	}
+	return nil
+}
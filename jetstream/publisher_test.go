@@ -0,0 +1,47 @@
+package jetstream_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+	conejetstream "github.com/zapling/cone/jetstream"
+)
+
+func TestPublisher(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	_ = getNatsConsumer(t, nc) // Sets up the stream
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+
+	e, _ := cone.NewEvent("publisher_event", []byte("body"))
+	e.Header.Set("type", "created")
+
+	if err := conejetstream.NewPublisher(js).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	stream, err := js.Stream(context.Background(), "jetstream-test")
+	if err != nil {
+		t.Fatalf("Failed to get stream: %s", err.Error())
+	}
+
+	msg, err := stream.GetLastMsgForSubject(context.Background(), "publisher_event")
+	if err != nil {
+		t.Fatalf("Failed to get published msg: %s", err.Error())
+	}
+	if string(msg.Data) != "body" || msg.Header.Get("type") != "created" {
+		t.Fatalf("Expected published body and header but got %q, %v", msg.Data, msg.Header)
+	}
+
+	t.Run("Subject outside stream", func(t *testing.T) {
+		e, _ := cone.NewEvent("not.in.stream", nil)
+		if err := conejetstream.NewPublisher(js).Publish(context.Background(), e); err == nil {
+			t.Fatalf("Expected error publishing outside of the stream")
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+)
+
+var (
+	ErrRetentionChanged = errors.New("retention can not be changed")
+)
+
+// SetupConfig declares a stream and a durable consumer on it.
+type SetupConfig struct {
+	// Stream is the name of the stream.
+	Stream string
+
+	// Subjects are the subjects stored in the stream.
+	Subjects []string
+
+	// Retention, if set, is the retention policy of the stream. If nil, the
+	// stream is created with jetstream.LimitsPolicy, and the policy of an
+	// existing stream is left as is. Retention can not be changed once the
+	// stream exists, Setup returns ErrRetentionChanged instead.
+	Retention *jetstream.RetentionPolicy
+
+	// Durable is the name of the consumer.
+	Durable string
+
+	// AckPolicy of the consumer, defaults to explicit acks.
+	AckPolicy jetstream.AckPolicy
+
+	// MaxDeliver is the number of delivery attempts for an event. Zero
+	// leaves it unlimited.
+	MaxDeliver int
+
+	// BackOff are the redelivery delays for events that are not responded
+	// to in time.
+	BackOff []time.Duration
+
+	// FilterSubjects limits the consumer to a subset of the stream. They
+	// must not overlap. If Mux is set, its subjects are used instead.
+	FilterSubjects []string
+
+	// Mux, if set, limits the consumer to the subjects registered on it,
+	// see CreateOrUpdateConsumer.
+	Mux *cone.HandlerMux
+
+	// DryRun only reports the changes that would be made.
+	DryRun bool
+}
+
+// Change is a difference between the declared and the existing
+// configuration of a stream or consumer.
+type Change struct {
+	// Resource is "stream" or "consumer".
+	Resource string
+	// Name of the stream or consumer.
+	Name string
+	// Field that differs, or empty if the resource does not exist.
+	Field string
+	From  string
+	To    string
+}
+
+func (c Change) String() string {
+	if c.Field == "" {
+		return fmt.Sprintf("create %s %s", c.Resource, c.Name)
+	}
+	return fmt.Sprintf("%s %s: %s %s -> %s", c.Resource, c.Name, c.Field, c.From, c.To)
+}
+
+// SetupResult is the outcome of Setup.
+type SetupResult struct {
+	// Consumer is the reconciled consumer, nil for a dry run.
+	Consumer jetstream.Consumer
+
+	// Changes that were made, or would have been for a dry run.
+	Changes []Change
+}
+
+// Setup creates the declared stream and consumer, or reconciles them if
+// they already exist. Settings that are not declared are left as they are.
+// Running it again with the same config makes no changes.
+func Setup(ctx context.Context, js jetstream.JetStream, cfg SetupConfig) (*SetupResult, error) {
+	if cfg.Stream == "" || cfg.Durable == "" {
+		return nil, fmt.Errorf("stream and durable name are required")
+	}
+	if len(cfg.Subjects) == 0 {
+		return nil, fmt.Errorf("stream subjects are required")
+	}
+
+	filterSubjects := cfg.FilterSubjects
+	if cfg.Mux != nil {
+		var err error
+		filterSubjects, err = cone.FilterSubjects(cfg.Mux.Routes())
+		if err != nil {
+			return nil, err
+		}
+		if len(filterSubjects) == 0 {
+			return nil, fmt.Errorf("mux has no routes")
+		}
+	}
+
+	if err := cone.CheckFilterSubjects(filterSubjects); err != nil {
+		return nil, err
+	}
+
+	if err := checkStreamCovers(cfg.Stream, cfg.Subjects, filterSubjects); err != nil {
+		return nil, err
+	}
+
+	result := &SetupResult{}
+
+	streamChanges, err := setupStream(ctx, js, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result.Changes = append(result.Changes, streamChanges...)
+
+	consumer, consumerChanges, err := setupConsumer(ctx, js, cfg, filterSubjects)
+	if err != nil {
+		return nil, err
+	}
+	result.Consumer = consumer
+	result.Changes = append(result.Changes, consumerChanges...)
+
+	return result, nil
+}
+
+func setupStream(ctx context.Context, js jetstream.JetStream, cfg SetupConfig) ([]Change, error) {
+	stream, err := js.Stream(ctx, cfg.Stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		changes := []Change{{Resource: "stream", Name: cfg.Stream}}
+		if cfg.DryRun {
+			return changes, nil
+		}
+
+		streamCfg := jetstream.StreamConfig{Name: cfg.Stream, Subjects: cfg.Subjects}
+		if cfg.Retention != nil {
+			streamCfg.Retention = *cfg.Retention
+		}
+		_, err := js.CreateStream(ctx, streamCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Stream, err)
+		}
+		return changes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %s: %w", cfg.Stream, err)
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %s info: %w", cfg.Stream, err)
+	}
+
+	existing := info.Config
+	if cfg.Retention != nil && existing.Retention != *cfg.Retention {
+		return nil, fmt.Errorf("%w: stream %s has %s, not %s", ErrRetentionChanged, cfg.Stream, existing.Retention, *cfg.Retention)
+	}
+
+	diff := differ{resource: "stream", name: cfg.Stream}
+	diff.compare("subjects", existing.Subjects, cfg.Subjects, slices.Equal(existing.Subjects, cfg.Subjects))
+
+	if len(diff.changes) == 0 || cfg.DryRun {
+		return diff.changes, nil
+	}
+
+	existing.Subjects = cfg.Subjects
+	if _, err := js.UpdateStream(ctx, existing); err != nil {
+		return nil, fmt.Errorf("failed to update stream %s: %w", cfg.Stream, err)
+	}
+
+	return diff.changes, nil
+}
+
+func setupConsumer(
+	ctx context.Context,
+	js jetstream.JetStream,
+	cfg SetupConfig,
+	filterSubjects []string,
+) (jetstream.Consumer, []Change, error) {
+	maxDeliver := cfg.MaxDeliver
+	if maxDeliver == 0 {
+		maxDeliver = -1 // What the server reports for unlimited
+	}
+
+	var existing jetstream.ConsumerConfig
+	var changes []Change
+
+	consumer, err := js.Consumer(ctx, cfg.Stream, cfg.Durable)
+	switch {
+	case errors.Is(err, jetstream.ErrConsumerNotFound), errors.Is(err, jetstream.ErrStreamNotFound):
+		existing = jetstream.ConsumerConfig{Durable: cfg.Durable}
+		changes = []Change{{Resource: "consumer", Name: cfg.Durable}}
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to get consumer %s: %w", cfg.Durable, err)
+	default:
+		existing = consumer.CachedInfo().Config
+
+		diff := differ{resource: "consumer", name: cfg.Durable}
+		existingFilter := existingFilterSubjects(existing)
+		diff.compare("ack policy", existing.AckPolicy, cfg.AckPolicy, existing.AckPolicy == cfg.AckPolicy)
+		diff.compare("max deliver", existing.MaxDeliver, maxDeliver, existing.MaxDeliver == maxDeliver)
+		diff.compare("backoff", existing.BackOff, cfg.BackOff, slices.Equal(existing.BackOff, cfg.BackOff))
+		diff.compare("filter subjects", existingFilter, filterSubjects, sameElements(existingFilter, filterSubjects))
+		changes = diff.changes
+
+		if len(changes) == 0 {
+			return consumer, nil, nil
+		}
+	}
+
+	if cfg.DryRun {
+		return nil, changes, nil
+	}
+
+	existing.AckPolicy = cfg.AckPolicy
+	existing.MaxDeliver = maxDeliver
+	existing.BackOff = cfg.BackOff
+	existing.FilterSubject = ""
+	existing.FilterSubjects = filterSubjects
+
+	consumer, err = js.CreateOrUpdateConsumer(ctx, cfg.Stream, existing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create or update consumer %s: %w", cfg.Durable, err)
+	}
+
+	return consumer, changes, nil
+}
+
+func existingFilterSubjects(cfg jetstream.ConsumerConfig) []string {
+	if cfg.FilterSubject != "" {
+		return []string{cfg.FilterSubject}
+	}
+	return cfg.FilterSubjects
+}
+
+type differ struct {
+	resource string
+	name     string
+	changes  []Change
+}
+
+// compare records a change of field from from to to, unless they are the
+// same.
+func (d *differ) compare(field string, from, to any, same bool) {
+	if same {
+		return
+	}
+	d.changes = append(d.changes, Change{
+		Resource: d.resource,
+		Name:     d.name,
+		Field:    field,
+		From:     fmt.Sprint(from),
+		To:       fmt.Sprint(to),
+	})
+}
+
+func sameElements(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
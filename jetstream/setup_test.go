@@ -0,0 +1,174 @@
+package jetstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zapling/cone"
+	conejetstream "github.com/zapling/cone/jetstream"
+)
+
+func TestSetup(t *testing.T) {
+	nc := getNatsConn(t)
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to get jetstream instance: %s", err.Error())
+	}
+
+	err = js.DeleteStream(context.Background(), "jetstream-setup-test")
+	if err != nil && !errors.Is(err, jetstream.ErrStreamNotFound) {
+		t.Fatalf("Failed to delete stream: %s", err.Error())
+	}
+	defer js.DeleteStream(context.Background(), "jetstream-setup-test")
+
+	cfg := conejetstream.SetupConfig{
+		Stream:     "jetstream-setup-test",
+		Subjects:   []string{"setup.>"},
+		Durable:    "setup-consumer",
+		MaxDeliver: 5,
+		BackOff:    []time.Duration{time.Second, 5 * time.Second},
+	}
+
+	t.Run("Dry run on missing resources", func(t *testing.T) {
+		cfg := cfg
+		cfg.DryRun = true
+		result, err := conejetstream.Setup(context.Background(), js, cfg)
+		if err != nil {
+			t.Fatalf("Failed to set up: %s", err.Error())
+		}
+
+		expected := "[create stream jetstream-setup-test create consumer setup-consumer]"
+		if fmt.Sprint(result.Changes) != expected {
+			t.Fatalf("Expected changes %s but got %v", expected, result.Changes)
+		}
+
+		_, err = js.Stream(context.Background(), "jetstream-setup-test")
+		if !errors.Is(err, jetstream.ErrStreamNotFound) {
+			t.Fatalf("Expected stream to not be created, got: %v", err)
+		}
+	})
+
+	t.Run("Creates stream and consumer", func(t *testing.T) {
+		result, err := conejetstream.Setup(context.Background(), js, cfg)
+		if err != nil {
+			t.Fatalf("Failed to set up: %s", err.Error())
+		}
+		if len(result.Changes) != 2 {
+			t.Fatalf("Expected 2 changes but got %v", result.Changes)
+		}
+		if result.Consumer.CachedInfo().Config.MaxDeliver != 5 {
+			t.Fatalf("Expected max deliver 5 but got %d", result.Consumer.CachedInfo().Config.MaxDeliver)
+		}
+	})
+
+	t.Run("Is idempotent", func(t *testing.T) {
+		result, err := conejetstream.Setup(context.Background(), js, cfg)
+		if err != nil {
+			t.Fatalf("Failed to set up: %s", err.Error())
+		}
+		if len(result.Changes) != 0 {
+			t.Fatalf("Expected no changes but got %v", result.Changes)
+		}
+		if result.Consumer == nil {
+			t.Fatal("Expected consumer but got nil")
+		}
+	})
+
+	t.Run("Reconciles changes", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("setup.created", func(_ cone.Response, _ *cone.Event) {})
+
+		cfg := cfg
+		cfg.MaxDeliver = 10
+		cfg.Mux = mux
+		result, err := conejetstream.Setup(context.Background(), js, cfg)
+		if err != nil {
+			t.Fatalf("Failed to set up: %s", err.Error())
+		}
+
+		expected := "[consumer setup-consumer: max deliver 5 -> 10 consumer setup-consumer: filter subjects [] -> [setup.created]]"
+		if fmt.Sprint(result.Changes) != expected {
+			t.Fatalf("Expected changes %s but got %v", expected, result.Changes)
+		}
+		if result.Consumer.CachedInfo().Config.MaxDeliver != 10 {
+			t.Fatalf("Expected max deliver 10 but got %d", result.Consumer.CachedInfo().Config.MaxDeliver)
+		}
+	})
+
+	t.Run("Changed retention should error", func(t *testing.T) {
+		cfg := cfg
+		interest := jetstream.InterestPolicy
+		cfg.Retention = &interest
+		_, err := conejetstream.Setup(context.Background(), js, cfg)
+		if !errors.Is(err, conejetstream.ErrRetentionChanged) {
+			t.Fatalf("Expected ErrRetentionChanged but got: %v", err)
+		}
+
+		stream, err := js.Stream(context.Background(), cfg.Stream)
+		if err != nil {
+			t.Fatalf("Failed to get stream: %s", err.Error())
+		}
+		if retention := stream.CachedInfo().Config.Retention; retention != jetstream.LimitsPolicy {
+			t.Fatalf("Expected retention %s but got %s", jetstream.LimitsPolicy, retention)
+		}
+	})
+
+	t.Run("Unset retention keeps existing retention", func(t *testing.T) {
+		_, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+			Name:      "jetstream-setup-workqueue-test",
+			Subjects:  []string{"setup-workqueue.>"},
+			Retention: jetstream.WorkQueuePolicy,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create stream: %s", err.Error())
+		}
+		defer js.DeleteStream(context.Background(), "jetstream-setup-workqueue-test")
+
+		cfg := cfg
+		cfg.Stream = "jetstream-setup-workqueue-test"
+		cfg.Subjects = []string{"setup-workqueue.>"}
+		result, err := conejetstream.Setup(context.Background(), js, cfg)
+		if err != nil {
+			t.Fatalf("Failed to set up: %s", err.Error())
+		}
+		expected := "[create consumer setup-consumer]"
+		if fmt.Sprint(result.Changes) != expected {
+			t.Fatalf("Expected changes %s but got %v", expected, result.Changes)
+		}
+	})
+
+	t.Run("Mux subjects outside of stream should error", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("orders.created", func(_ cone.Response, _ *cone.Event) {})
+
+		cfg := cfg
+		cfg.Mux = mux
+		_, err := conejetstream.Setup(context.Background(), js, cfg)
+		if !errors.Is(err, conejetstream.ErrSubjectNotInStream) {
+			t.Fatalf("Expected ErrSubjectNotInStream but got: %v", err)
+		}
+	})
+
+	t.Run("Overlapping subjects should error", func(t *testing.T) {
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("setup.*.created", func(_ cone.Response, _ *cone.Event) {})
+		mux.HandleFunc("setup.eu.>", func(_ cone.Response, _ *cone.Event) {})
+
+		cfg := cfg
+		cfg.Mux = mux
+		if _, err := conejetstream.Setup(context.Background(), js, cfg); !errors.Is(err, cone.ErrOverlappingSubjects) {
+			t.Fatalf("Expected ErrOverlappingSubjects from mux but got: %v", err)
+		}
+
+		cfg.Mux = nil
+		cfg.FilterSubjects = []string{"setup.*.created", "setup.eu.>"}
+		if _, err := conejetstream.Setup(context.Background(), js, cfg); !errors.Is(err, cone.ErrOverlappingSubjects) {
+			t.Fatalf("Expected ErrOverlappingSubjects from filter subjects but got: %v", err)
+		}
+	})
+}
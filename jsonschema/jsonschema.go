@@ -0,0 +1,225 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/zapling/cone"
+)
+
+// ErrorHeader is the header the validation errors are attached to on events
+// passed to OnInvalid, one value per error.
+const ErrorHeader = "validation-error"
+
+var (
+	ErrInvalidBody = errors.New("invalid event body")
+)
+
+// Compile compiles a JSON Schema document.
+func Compile(schema []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+
+	s, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
+	}
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the schema can not be compiled.
+func MustCompile(schema []byte) *jsonschema.Schema {
+	s, err := Compile(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ValidationError describes why an event body did not validate.
+type ValidationError struct {
+	// Subject of the event.
+	Subject string
+
+	// Errors lists the validation errors, as "location: message" where
+	// location is a JSON pointer into the body, or as the message alone for
+	// errors about the body as a whole.
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s for %s: %s", ErrInvalidBody, e.Subject, strings.Join(e.Errors, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidBody
+}
+
+// Stats counts the events a Validator found invalid.
+type Stats struct {
+	// Total is the number of invalid events.
+	Total uint64
+
+	// Subjects counts the invalid events per registered subject.
+	Subjects map[string]uint64
+}
+
+// Validator validates event bodies against JSON Schemas registered per
+// subject. It is used as middleware on a cone.HandlerMux.
+//
+//	v := jsonschema.NewValidator()
+//	v.Register("orders.created", jsonschema.MustCompile(schema))
+//	mux.Use(v.Middleware)
+type Validator struct {
+	// OnInvalid responds to events with an invalid body. The event has the
+	// validation errors attached under ErrorHeader, so it can be published
+	// to a dead-letter subject as is. If nil, invalid events are terminated
+	// with cone.Term.
+	OnInvalid func(r cone.Response, e *cone.Event, err *ValidationError)
+
+	schemas map[string]*jsonschema.Schema
+
+	mu       sync.Mutex
+	total    uint64
+	subjects map[string]uint64
+}
+
+func NewValidator() *Validator {
+	return &Validator{schemas: make(map[string]*jsonschema.Schema)}
+}
+
+// Register registers schema for events with a subject matching pattern.
+// When several patterns match, the most specific one is used.
+func (v *Validator) Register(pattern string, schema *jsonschema.Schema) {
+	if pattern == "" {
+		panic("empty subject is not allowed")
+	}
+	if schema == nil {
+		panic("schema is nil")
+	}
+	if v.schemas == nil {
+		v.schemas = make(map[string]*jsonschema.Schema)
+	}
+	v.schemas[pattern] = schema
+}
+
+// Validate validates the body of e against the schema registered for its
+// subject. Events without a schema are valid.
+func (v *Validator) Validate(e *cone.Event) error {
+	if err := v.validate(e); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Validator) validate(e *cone.Event) *ValidationError {
+	pattern, ok := cone.MostSpecificPattern(e.Subject, slices.Collect(maps.Keys(v.schemas)))
+	if !ok {
+		return nil
+	}
+
+	if errs := validateBody(v.schemas[pattern], e.Body); errs != nil {
+		v.count(pattern)
+		return &ValidationError{Subject: e.Subject, Errors: errs}
+	}
+	return nil
+}
+
+// Middleware validates events before passing them to next.
+func (v *Validator) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		validationErr := v.validate(e)
+		if validationErr == nil {
+			next.Serve(r, e)
+			return
+		}
+
+		invalid := e.WithContext(e.Context())
+		invalid.Header = maps.Clone(e.Header)
+		if invalid.Header == nil {
+			invalid.Header = make(cone.Header)
+		}
+		for _, msg := range validationErr.Errors {
+			invalid.Header.Add(ErrorHeader, msg)
+		}
+
+		if v.OnInvalid != nil {
+			v.OnInvalid(r, invalid, validationErr)
+			return
+		}
+		_ = cone.Term(r)
+	})
+}
+
+// Stats returns how many events were found invalid.
+func (v *Validator) Stats() Stats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return Stats{Total: v.total, Subjects: maps.Clone(v.subjects)}
+}
+
+func (v *Validator) count(pattern string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.total++
+	if v.subjects == nil {
+		v.subjects = make(map[string]uint64)
+	}
+	v.subjects[pattern]++
+}
+
+// validateBody returns the validation errors of body, or nil if it is
+// valid.
+func validateBody(schema *jsonschema.Schema, body []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return []string{"body is not valid JSON: " + err.Error()}
+	}
+	if dec.More() {
+		return []string{"body is not valid JSON: unexpected data after value"}
+	}
+
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []string{err.Error()}
+	}
+
+	var errs []string
+	for _, e := range validationErr.BasicOutput().Errors {
+		// Skip the errors that only summarise their causes
+		if strings.HasPrefix(e.Error, "doesn't validate with") {
+			continue
+		}
+		errs = append(errs, formatError(e.InstanceLocation, e.Error))
+	}
+	if len(errs) == 0 {
+		errs = []string{formatError(validationErr.InstanceLocation, validationErr.Message)}
+	}
+	slices.Sort(errs) // Properties are validated in no particular order
+	return errs
+}
+
+func formatError(location, msg string) string {
+	if location == "" {
+		return msg
+	}
+	return location + ": " + msg
+}
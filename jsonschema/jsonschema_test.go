@@ -0,0 +1,161 @@
+package jsonschema_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/jsonschema"
+)
+
+var orderSchema = []byte(`{
+	"type": "object",
+	"required": ["id"],
+	"properties": {
+		"id": {"type": "string"},
+		"amount": {"type": "integer", "minimum": 1}
+	}
+}`)
+
+func newValidator() *jsonschema.Validator {
+	v := jsonschema.NewValidator()
+	v.Register("orders.created", jsonschema.MustCompile(orderSchema))
+	v.Register("orders.>", jsonschema.MustCompile([]byte(`{"type": "object"}`)))
+	return v
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := jsonschema.Compile([]byte(`{"type": 1}`)); err == nil {
+		t.Fatalf("Expected invalid schema to fail compiling")
+	}
+	if _, err := jsonschema.Compile([]byte(`{`)); err == nil {
+		t.Fatalf("Expected malformed schema to fail compiling")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		body     string
+		expected []string
+	}{
+		{name: "Valid", subject: "orders.created", body: `{"id": "1", "amount": 5}`},
+		{name: "Missing property", subject: "orders.created", body: `{}`, expected: []string{"missing properties: 'id'"}},
+		{
+			name:     "Several errors",
+			subject:  "orders.created",
+			body:     `{"id": 1, "amount": 0}`,
+			expected: []string{"/amount: must be >= 1 but found 0", "/id: expected string, but got number"},
+		},
+		{name: "Not JSON", subject: "orders.created", body: `id=1`, expected: []string{"body is not valid JSON: invalid character 'i' looking for beginning of value"}},
+		{name: "Trailing data", subject: "orders.created", body: `{"id": "1"} {}`, expected: []string{"body is not valid JSON: unexpected data after value"}},
+		{name: "Wildcard schema", subject: "orders.deleted", body: `[]`, expected: []string{"expected object, but got array"}},
+		{name: "No schema", subject: "users.created", body: `not json`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newValidator().Validate(conetest.NewEvent(test.subject, []byte(test.body)))
+			if test.expected == nil {
+				if err != nil {
+					t.Fatalf("Expected no error but got %v", err)
+				}
+				return
+			}
+
+			var validationErr *jsonschema.ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, jsonschema.ErrInvalidBody) {
+				t.Fatalf("Expected ValidationError but got %v", err)
+			}
+			if !slices.Equal(validationErr.Errors, test.expected) {
+				t.Fatalf("Expected errors %q but got %q", test.expected, validationErr.Errors)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Valid events reach the handler", func(t *testing.T) {
+		called := false
+		mux := cone.NewHandlerMux()
+		mux.Use(newValidator().Middleware)
+		mux.HandleFunc("orders.created", func(_ cone.Response, _ *cone.Event) { called = true })
+
+		r := conetest.NewRecorder()
+		mux.Serve(r, conetest.NewEvent("orders.created", []byte(`{"id": "1"}`)))
+		if !called {
+			t.Fatalf("Expected handler to be called")
+		}
+		if r.Result() != conetest.Ack {
+			t.Fatalf("Expected Ack but got %s", r.Result())
+		}
+	})
+
+	t.Run("Invalid events are terminated", func(t *testing.T) {
+		called := false
+		mux := cone.NewHandlerMux()
+		mux.Use(newValidator().Middleware)
+		mux.HandleFunc("orders.created", func(_ cone.Response, _ *cone.Event) { called = true })
+
+		r := conetest.NewRecorder()
+		mux.Serve(r, conetest.NewEvent("orders.created", []byte(`{}`)))
+		if called {
+			t.Fatalf("Expected handler not to be called")
+		}
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected Term but got %s", r.Result())
+		}
+	})
+
+	t.Run("OnInvalid gets errors attached", func(t *testing.T) {
+		v := newValidator()
+		var deadLettered *cone.Event
+		v.OnInvalid = func(r cone.Response, e *cone.Event, _ *jsonschema.ValidationError) {
+			deadLettered = e
+			_ = r.Ack()
+		}
+
+		e := conetest.NewEvent("orders.created", []byte(`{"id": 1, "amount": 0}`))
+		r := conetest.NewRecorder()
+		v.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {})).Serve(r, e)
+
+		if r.Result() != conetest.Ack {
+			t.Fatalf("Expected Ack but got %s", r.Result())
+		}
+		if deadLettered == nil {
+			t.Fatalf("Expected OnInvalid to be called")
+		}
+		if errs := deadLettered.Header.Values(jsonschema.ErrorHeader); len(errs) != 2 {
+			t.Fatalf("Expected 2 errors attached but got %q", errs)
+		}
+		if len(e.Header.Values(jsonschema.ErrorHeader)) != 0 {
+			t.Fatalf("Expected original event to be unchanged")
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	v := newValidator()
+	handler := v.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {}))
+
+	for _, e := range []*cone.Event{
+		conetest.NewEvent("orders.created", []byte(`{}`)),
+		conetest.NewEvent("orders.created", []byte(`{"id": "1"}`)),
+		conetest.NewEvent("orders.created", []byte(`[]`)),
+		conetest.NewEvent("orders.deleted", []byte(`1`)),
+		conetest.NewEvent("users.created", []byte(`1`)),
+	} {
+		handler.Serve(conetest.NewRecorder(), e)
+	}
+
+	stats := v.Stats()
+	if stats.Total != 3 {
+		t.Fatalf("Expected 3 invalid events but got %d", stats.Total)
+	}
+	if stats.Subjects["orders.created"] != 2 || stats.Subjects["orders.>"] != 1 {
+		t.Fatalf("Expected invalid events counted per schema but got %v", stats.Subjects)
+	}
+}
@@ -0,0 +1,105 @@
+package cone
+
+import (
+	"slices"
+	"strings"
+)
+
+// Matcher matches events on their subject and headers, for routes
+// registered with HandlerMux.HandleMatch.
+type Matcher struct {
+	subject string
+	headers []headerMatch
+}
+
+type headerMatch struct {
+	key   string
+	value string
+}
+
+// Subject returns a Matcher for events with a subject matching pattern,
+// which may contain NATS wildcards.
+func Subject(pattern string) Matcher {
+	return Matcher{subject: pattern}
+}
+
+// Header returns a copy of m that also requires the event to have value
+// among the values of the header key.
+func (m Matcher) Header(key, value string) Matcher {
+	m.headers = append(slices.Clip(m.headers), headerMatch{key: key, value: value})
+	return m
+}
+
+// Match reports whether the event matches.
+func (m Matcher) Match(e *Event) bool {
+	return m.match(e.Subject, e.Header)
+}
+
+func (m Matcher) match(subject string, header Header) bool {
+	if !matchSubject(m.subject, subject) {
+		return false
+	}
+	for _, h := range m.headers {
+		if !slices.Contains(header.Values(h.key), h.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Matcher) String() string {
+	var b strings.Builder
+	b.WriteString(m.subject)
+	for _, h := range m.headers {
+		b.WriteString(" " + h.key + "=" + h.value)
+	}
+	return b.String()
+}
+
+// matchSubject reports whether subject matches pattern.
+func matchSubject(pattern, subject string) bool {
+	if !hasWildcard(pattern) {
+		return pattern == subject
+	}
+	return SubjectCovers(pattern, subject)
+}
+
+func hasWildcard(pattern string) bool {
+	for _, token := range strings.Split(pattern, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSpecificity orders subject patterns from most to least specific:
+// patterns with more literal tokens first, and of those, patterns without a
+// trailing ">" first.
+func compareSpecificity(a, b string) int {
+	literalsA, fullA := patternShape(a)
+	literalsB, fullB := patternShape(b)
+	if literalsA != literalsB {
+		return literalsB - literalsA
+	}
+	if fullA != fullB {
+		if fullA {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+func patternShape(pattern string) (literals int, fullWildcard bool) {
+	for _, token := range strings.Split(pattern, ".") {
+		switch token {
+		case "*":
+		case ">":
+			fullWildcard = true
+		default:
+			literals++
+		}
+	}
+	return literals, fullWildcard
+}
@@ -0,0 +1,27 @@
+package cone_test
+
+import (
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestMatcher(t *testing.T) {
+	m := cone.Subject("orders.*").Header("type", "created")
+
+	e := conetest.NewEvent("orders.v1", nil)
+	e.Header.Add("type", "updated")
+	if m.Match(e) {
+		t.Fatal("Expected event without the header value to not match")
+	}
+
+	e.Header.Add("type", "created")
+	if !m.Match(e) {
+		t.Fatal("Expected event with the header value among others to match")
+	}
+
+	if m.String() != "orders.* type=created" {
+		t.Fatalf("Unexpected string: %s", m.String())
+	}
+}
@@ -0,0 +1,27 @@
+package cone
+
+import "time"
+
+// Metrics receives measurements from a Consumer and a HandlerMux. The
+// metrics package has implementations for expvar and Prometheus.
+// Implementations must be safe for concurrent use, and should not block.
+//
+// Subjects are passed as is, so implementations labelling by subject should
+// keep in mind that wildcard routes can receive any number of subjects.
+type Metrics interface {
+	// EventStarted is called when the consumer receives an event and starts
+	// handling it.
+	EventStarted(subject string)
+
+	// EventHandled is called when the handler of an event returns, with how
+	// the event was responded to and how long handling it took. Events
+	// started but not yet handled are in flight.
+	EventHandled(subject string, outcome Outcome, duration time.Duration)
+
+	// HandlerPanicked is called instead of EventHandled when the handler of
+	// an event panics, before the panic continues.
+	HandlerPanicked(subject string)
+
+	// UnknownSubject is called by a HandlerMux for events without a route.
+	UnknownSubject(subject string)
+}
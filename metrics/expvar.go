@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+var _ cone.Metrics = &Expvar{}
+
+// DefaultBuckets are the upper bounds, in seconds, of the handler duration
+// histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Expvar is a cone.Metrics keeping its measurements in an expvar.Map, with
+// one map per measurement keyed by subject:
+//
+//	started           events received
+//	in_flight         events being handled
+//	ack, nak, term    events handled, by how they were responded to
+//	none              events handled without a response
+//	panics            handler panics
+//	unknown_subjects  events without a route in the HandlerMux
+//	duration_seconds  histograms of how long handling took
+type Expvar struct {
+	// Buckets of the duration histograms. If nil, DefaultBuckets is used.
+	// It must not be changed once events are handled.
+	Buckets []float64
+
+	vars      *expvar.Map
+	started   *expvar.Map
+	inFlight  *expvar.Map
+	outcomes  map[cone.Outcome]*expvar.Map
+	panics    *expvar.Map
+	unknown   *expvar.Map
+	durations *expvar.Map
+
+	mu sync.Mutex
+}
+
+// NewExpvar returns Expvar metrics published under name, as with
+// expvar.Publish. If name is empty, they are not published, and are only
+// available through Var.
+func NewExpvar(name string) *Expvar {
+	m := &Expvar{
+		vars:      new(expvar.Map),
+		started:   new(expvar.Map),
+		inFlight:  new(expvar.Map),
+		panics:    new(expvar.Map),
+		unknown:   new(expvar.Map),
+		durations: new(expvar.Map),
+		outcomes:  make(map[cone.Outcome]*expvar.Map),
+	}
+
+	m.vars.Set("started", m.started)
+	m.vars.Set("in_flight", m.inFlight)
+	for _, outcome := range []cone.Outcome{cone.OutcomeAck, cone.OutcomeNak, cone.OutcomeTerm, cone.OutcomeNone} {
+		m.outcomes[outcome] = new(expvar.Map)
+		m.vars.Set(string(outcome), m.outcomes[outcome])
+	}
+	m.vars.Set("panics", m.panics)
+	m.vars.Set("unknown_subjects", m.unknown)
+	m.vars.Set("duration_seconds", m.durations)
+
+	if name != "" {
+		expvar.Publish(name, m.vars)
+	}
+	return m
+}
+
+// Var returns the map holding the metrics.
+func (m *Expvar) Var() *expvar.Map {
+	return m.vars
+}
+
+// Counters returns the counts per subject of each measurement but the
+// duration histograms, keyed by the names listed on Expvar.
+func (m *Expvar) Counters() map[string]map[string]int64 {
+	counters := make(map[string]map[string]int64)
+	m.vars.Do(func(kv expvar.KeyValue) {
+		if kv.Value == m.durations {
+			return
+		}
+		counts := make(map[string]int64)
+		kv.Value.(*expvar.Map).Do(func(kv expvar.KeyValue) {
+			if count, ok := kv.Value.(*expvar.Int); ok {
+				counts[kv.Key] = count.Value()
+			}
+		})
+		counters[kv.Key] = counts
+	})
+	return counters
+}
+
+func (m *Expvar) EventStarted(subject string) {
+	m.started.Add(subject, 1)
+	m.inFlight.Add(subject, 1)
+}
+
+func (m *Expvar) EventHandled(subject string, outcome cone.Outcome, duration time.Duration) {
+	m.inFlight.Add(subject, -1)
+	if counts, ok := m.outcomes[outcome]; ok {
+		counts.Add(subject, 1)
+	}
+	m.histogram(subject).observe(duration.Seconds())
+}
+
+func (m *Expvar) HandlerPanicked(subject string) {
+	m.inFlight.Add(subject, -1)
+	m.panics.Add(subject, 1)
+}
+
+func (m *Expvar) UnknownSubject(subject string) {
+	m.unknown.Add(subject, 1)
+}
+
+func (m *Expvar) histogram(subject string) *histogram {
+	if h, ok := m.durations.Get(subject).(*histogram); ok {
+		return h
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if h, ok := m.durations.Get(subject).(*histogram); ok {
+		return h
+	}
+	h := newHistogram(m.Buckets)
+	m.durations.Set(subject, h)
+	return h
+}
+
+// histogram is an expvar.Var counting observations in cumulative buckets,
+// the way Prometheus does.
+type histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	if bounds == nil {
+		bounds = DefaultBuckets
+	}
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]uint64, len(h.bounds)+1)
+	for i, bound := range h.bounds {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = h.counts[i]
+	}
+	buckets["+Inf"] = h.count
+
+	b, _ := json.Marshal(struct {
+		Buckets map[string]uint64 `json:"buckets"`
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+	}{buckets, h.count, h.sum})
+	return string(b)
+}
@@ -0,0 +1,113 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/metrics"
+)
+
+func TestExpvar(t *testing.T) {
+	t.Run("Should count events by subject", func(t *testing.T) {
+		m := metrics.NewExpvar("")
+		m.EventStarted("event.a")
+		m.EventStarted("event.a")
+		m.EventStarted("event.b")
+		m.EventHandled("event.a", cone.OutcomeAck, time.Millisecond)
+		m.EventHandled("event.a", cone.OutcomeNak, time.Millisecond)
+		m.HandlerPanicked("event.b")
+		m.UnknownSubject("event.c")
+
+		counts := map[string]int64{
+			"started/event.a":          2,
+			"started/event.b":          1,
+			"in_flight/event.a":        0,
+			"in_flight/event.b":        0,
+			"ack/event.a":              1,
+			"nak/event.a":              1,
+			"panics/event.b":           1,
+			"unknown_subjects/event.c": 1,
+		}
+		for key, expected := range counts {
+			if got := intVar(t, m.Var(), key); got != expected {
+				t.Fatalf("Expected %s to be %d but got %d", key, expected, got)
+			}
+		}
+	})
+
+	t.Run("Should report counters without durations", func(t *testing.T) {
+		m := metrics.NewExpvar("")
+		m.EventStarted("event.subject")
+		m.EventHandled("event.subject", cone.OutcomeAck, time.Millisecond)
+
+		counters := m.Counters()
+		if counters["started"]["event.subject"] != 1 || counters["ack"]["event.subject"] != 1 {
+			t.Fatalf("Expected 1 started and acked event but got %v", counters)
+		}
+		if _, ok := counters["duration_seconds"]; ok {
+			t.Fatalf("Expected no durations but got %v", counters["duration_seconds"])
+		}
+	})
+
+	t.Run("Should record durations in cumulative buckets", func(t *testing.T) {
+		m := metrics.NewExpvar("")
+		m.Buckets = []float64{0.1, 1}
+		m.EventHandled("event.subject", cone.OutcomeAck, 50*time.Millisecond)
+		m.EventHandled("event.subject", cone.OutcomeAck, 500*time.Millisecond)
+		m.EventHandled("event.subject", cone.OutcomeAck, 5*time.Second)
+
+		durations := m.Var().Get("duration_seconds").(*expvar.Map)
+		var histogram struct {
+			Buckets map[string]uint64
+			Count   uint64
+			Sum     float64
+		}
+		if err := json.Unmarshal([]byte(durations.Get("event.subject").String()), &histogram); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+
+		expected := map[string]uint64{"0.1": 1, "1": 2, "+Inf": 3}
+		for bucket, count := range expected {
+			if histogram.Buckets[bucket] != count {
+				t.Fatalf("Expected %d in bucket %s but got %d", count, bucket, histogram.Buckets[bucket])
+			}
+		}
+		if histogram.Count != 3 {
+			t.Fatalf("Expected count 3 but got %d", histogram.Count)
+		}
+		if histogram.Sum < 5.54 || histogram.Sum > 5.56 {
+			t.Fatalf("Expected sum 5.55 but got %f", histogram.Sum)
+		}
+	})
+
+	t.Run("Should publish under name", func(t *testing.T) {
+		m := metrics.NewExpvar("cone_test")
+		if expvar.Get("cone_test") != m.Var() {
+			t.Fatal("Expected metrics to be published")
+		}
+	})
+}
+
+func intVar(t *testing.T, vars *expvar.Map, key string) int64 {
+	t.Helper()
+
+	for i := range key {
+		if key[i] != '/' {
+			continue
+		}
+		m, ok := vars.Get(key[:i]).(*expvar.Map)
+		if !ok {
+			t.Fatalf("Expected map %s but got none", key[:i])
+		}
+		v, ok := m.Get(key[i+1:]).(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return v.Value()
+	}
+	t.Fatalf("Expected map/key but got %s", key)
+	return 0
+}
@@ -0,0 +1,20 @@
+module github.com/zapling/cone/metrics/prometheus
+
+go 1.23.0
+
+require (
+	github.com/prometheus/client_golang v1.23.0
+	github.com/zapling/cone v0.0.0-20261019101924-e98c2bf3b056
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.65.0 // indirect
+	github.com/prometheus/procfs v0.16.1 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	google.golang.org/protobuf v1.36.12 // indirect
+)
@@ -0,0 +1,94 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zapling/cone"
+)
+
+var _ cone.Metrics = &Metrics{}
+
+// Metrics is a cone.Metrics recording to Prometheus collectors, labelled
+// by subject:
+//
+//	cone_events_started_total{subject}
+//	cone_events_in_flight{subject}
+//	cone_events_handled_total{subject,outcome}
+//	cone_handler_duration_seconds{subject}
+//	cone_handler_panics_total{subject}
+//	cone_unknown_subjects_total{subject}
+type Metrics struct {
+	started  *prometheus.CounterVec
+	inFlight *prometheus.GaugeVec
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	panics   *prometheus.CounterVec
+	unknown  *prometheus.CounterVec
+}
+
+// New returns Metrics with its collectors registered with reg, or with
+// prometheus.DefaultRegisterer if reg is nil. It panics if they can not be
+// registered.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cone",
+			Name:      "events_started_total",
+			Help:      "Events received and passed to the handler.",
+		}, []string{"subject"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "cone",
+			Name:      "events_in_flight",
+			Help:      "Events being handled.",
+		}, []string{"subject"}),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cone",
+			Name:      "events_handled_total",
+			Help:      "Events handled, by how they were responded to.",
+		}, []string{"subject", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "cone",
+			Name:      "handler_duration_seconds",
+			Help:      "How long handling events took.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"subject"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cone",
+			Name:      "handler_panics_total",
+			Help:      "Handlers that panicked.",
+		}, []string{"subject"}),
+		unknown: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cone",
+			Name:      "unknown_subjects_total",
+			Help:      "Events without a route in the handler mux.",
+		}, []string{"subject"}),
+	}
+
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	reg.MustRegister(m.started, m.inFlight, m.handled, m.duration, m.panics, m.unknown)
+
+	return m
+}
+
+func (m *Metrics) EventStarted(subject string) {
+	m.started.WithLabelValues(subject).Inc()
+	m.inFlight.WithLabelValues(subject).Inc()
+}
+
+func (m *Metrics) EventHandled(subject string, outcome cone.Outcome, duration time.Duration) {
+	m.inFlight.WithLabelValues(subject).Dec()
+	m.handled.WithLabelValues(subject, string(outcome)).Inc()
+	m.duration.WithLabelValues(subject).Observe(duration.Seconds())
+}
+
+func (m *Metrics) HandlerPanicked(subject string) {
+	m.inFlight.WithLabelValues(subject).Dec()
+	m.panics.WithLabelValues(subject).Inc()
+}
+
+func (m *Metrics) UnknownSubject(subject string) {
+	m.unknown.WithLabelValues(subject).Inc()
+}
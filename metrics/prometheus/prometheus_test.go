@@ -0,0 +1,64 @@
+package prometheus_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zapling/cone"
+	conemetrics "github.com/zapling/cone/metrics/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("Should record to collectors", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		m := conemetrics.New(reg)
+
+		m.EventStarted("event.a")
+		m.EventStarted("event.a")
+		m.EventStarted("event.b")
+		m.EventHandled("event.a", cone.OutcomeAck, time.Millisecond)
+		m.EventHandled("event.a", cone.OutcomeTerm, time.Millisecond)
+		m.HandlerPanicked("event.b")
+		m.UnknownSubject("event.c")
+
+		count, err := testutil.GatherAndCount(reg)
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		// started: 2, in flight: 2, handled: 2, duration: 1, panics: 1, unknown: 1
+		if count != 9 {
+			t.Fatalf("Expected 9 series but got %d", count)
+		}
+
+		for name, expected := range map[string]int{
+			"cone_events_started_total":     2,
+			"cone_events_in_flight":         2,
+			"cone_events_handled_total":     2,
+			"cone_handler_duration_seconds": 1,
+			"cone_handler_panics_total":     1,
+			"cone_unknown_subjects_total":   1,
+		} {
+			count, err := testutil.GatherAndCount(reg, name)
+			if err != nil {
+				t.Fatalf("Expected nil but got err: %s", err.Error())
+			}
+			if count != expected {
+				t.Fatalf("Expected %d series of %s but got %d", expected, name, count)
+			}
+		}
+	})
+
+	t.Run("Registering twice should panic", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		conemetrics.New(reg)
+
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected panic but got none")
+			}
+		}()
+		conemetrics.New(reg)
+	})
+}
@@ -0,0 +1,136 @@
+package cone_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	started  []string
+	handled  map[string]cone.Outcome
+	inFlight int
+	unknown  []string
+}
+
+func (m *recordingMetrics) EventStarted(subject string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = append(m.started, subject)
+	m.inFlight++
+}
+
+func (m *recordingMetrics) EventHandled(subject string, outcome cone.Outcome, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handled == nil {
+		m.handled = make(map[string]cone.Outcome)
+	}
+	m.handled[subject] = outcome
+	m.inFlight--
+}
+
+func (m *recordingMetrics) HandlerPanicked(string) {}
+
+func (m *recordingMetrics) UnknownSubject(subject string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unknown = append(m.unknown, subject)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("Consumer should record outcomes", func(t *testing.T) {
+		metrics := &recordingMetrics{}
+
+		h := cone.NewHandlerMux()
+		h.AutoAck = cone.AutoAckNever
+		h.Metrics = metrics
+		h.HandleFunc("event.ack", func(r cone.Response, _ *cone.Event) {
+			_ = r.Ack()
+			_ = r.Nak()
+		})
+		h.HandleFunc("event.nak", func(r cone.Response, _ *cone.Event) {
+			_ = r.Nak()
+		})
+		h.HandleFunc("event.term", func(r cone.Response, _ *cone.Event) {
+			_ = cone.Term(r)
+		})
+		h.HandleFunc("event.none", func(cone.Response, *cone.Event) {})
+
+		s := conetest.NewSource()
+		for _, subject := range []string{"event.ack", "event.nak", "event.term", "event.none", "event.unknown"} {
+			s.AddEvent(conetest.NewEvent(subject, nil))
+		}
+
+		c := cone.New(s, h)
+		c.Metrics = metrics
+
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+
+		if len(metrics.started) != 5 {
+			t.Fatalf("Expected 5 started events but got %d", len(metrics.started))
+		}
+		if metrics.inFlight != 0 {
+			t.Fatalf("Expected no events in flight but got %d", metrics.inFlight)
+		}
+
+		expected := map[string]cone.Outcome{
+			"event.ack":  cone.OutcomeAck,
+			"event.nak":  cone.OutcomeNak,
+			"event.term": cone.OutcomeTerm,
+			"event.none": cone.OutcomeNone,
+		}
+		for subject, outcome := range expected {
+			if metrics.handled[subject] != outcome {
+				t.Fatalf("Expected %s to be handled with %s but got %s", subject, outcome, metrics.handled[subject])
+			}
+		}
+
+		// The mux naks unknown subjects
+		if metrics.handled["event.unknown"] != cone.OutcomeNak {
+			t.Fatalf("Expected event.unknown to be handled with nak but got %s", metrics.handled["event.unknown"])
+		}
+		if len(metrics.unknown) != 1 || metrics.unknown[0] != "event.unknown" {
+			t.Fatalf("Expected unknown subject event.unknown but got %v", metrics.unknown)
+		}
+	})
+
+	t.Run("Auto ack should be recorded", func(t *testing.T) {
+		metrics := &recordingMetrics{}
+
+		h := cone.NewHandlerMux()
+		h.HandleFunc("event.subject", func(cone.Response, *cone.Event) {})
+
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+
+		c := cone.New(s, h)
+		c.Metrics = metrics
+
+		stopped := startConsumer(t, c)
+		time.Sleep(5 * time.Millisecond)
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		waitStopped(t, stopped)
+
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		if metrics.handled["event.subject"] != cone.OutcomeAck {
+			t.Fatalf("Expected ack but got %s", metrics.handled["event.subject"])
+		}
+	})
+}
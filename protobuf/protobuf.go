@@ -0,0 +1,194 @@
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/zapling/cone"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// TypeHeader holds the full name of the message in the event body, like
+	// "acme.orders.v1.OrderCreated".
+	TypeHeader = "proto-type"
+
+	// ContentType is the media type of protobuf event bodies. The message
+	// name may also be given as its "proto" parameter.
+	ContentType = "application/protobuf"
+)
+
+var (
+	ErrNoMessageType      = errors.New("event has no protobuf message type")
+	ErrUnknownMessageType = errors.New("unknown protobuf message type")
+)
+
+// Codec encodes and decodes protobuf event bodies. The message type of an
+// event is read from TypeHeader, or from the "proto" parameter of its
+// Content-Type header, and looked up in Types.
+//
+// Routes can match on the message type with HandlerMux.HandleMatch:
+//
+//	mux.HandleMatch(cone.Subject("orders.>").Header(protobuf.TypeHeader, "acme.orders.v1.OrderCreated"), h)
+type Codec struct {
+	// Types resolves message types by their full name. Defaults to
+	// protoregistry.GlobalTypes, which holds the generated Go types linked
+	// into the binary.
+	Types protoregistry.MessageTypeResolver
+}
+
+// NewCodecFromDescriptors returns a Codec for the messages described in set,
+// without needing their generated Go types. Messages are decoded as
+// *dynamicpb.Message.
+func NewCodecFromDescriptors(set *descriptorpb.FileDescriptorSet) (*Codec, error) {
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load descriptors: %w", err)
+	}
+
+	types := new(protoregistry.Types)
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		err = registerMessages(types, fd.Messages())
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Codec{Types: types}, nil
+}
+
+func registerMessages(types *protoregistry.Types, messages protoreflect.MessageDescriptors) error {
+	for i := range messages.Len() {
+		md := messages.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		if err := types.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+			return fmt.Errorf("failed to register %s: %w", md.FullName(), err)
+		}
+		if err := registerMessages(types, md.Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode returns an event with msg as body, and the headers needed to
+// decode it.
+func (c *Codec) Encode(subject string, msg proto.Message) (*cone.Event, error) {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+	}
+
+	e, err := cone.NewEvent(subject, body)
+	if err != nil {
+		return nil, err
+	}
+	e.Header.Set("Content-Type", ContentType)
+	e.Header.Set(TypeHeader, string(msg.ProtoReflect().Descriptor().FullName()))
+	return e, nil
+}
+
+// Decode returns the message in the body of e.
+func (c *Codec) Decode(e *cone.Event) (proto.Message, error) {
+	mt, err := c.MessageType(e)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := mt.New().Interface()
+	if err := proto.Unmarshal(e.Body, msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", mt.Descriptor().FullName(), err)
+	}
+	return msg, nil
+}
+
+// MessageType returns the type of the message in the body of e.
+func (c *Codec) MessageType(e *cone.Event) (protoreflect.MessageType, error) {
+	name, err := messageName(e)
+	if err != nil {
+		return nil, err
+	}
+
+	mt, err := c.types().FindMessageByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s", ErrUnknownMessageType, name)
+	}
+	return mt, nil
+}
+
+// Text renders the message in the body of e on a single line, for logs and
+// tooling.
+func (c *Codec) Text(e *cone.Event) (string, error) {
+	msg, err := c.Decode(e)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s{%s}", msg.ProtoReflect().Descriptor().FullName(), prototext.MarshalOptions{}.Format(msg)), nil
+}
+
+// Handler returns a handler that decodes events and passes the message to
+// fn. Events that can not be decoded are terminated, as redelivering them
+// would not help.
+func (c *Codec) Handler(fn func(r cone.Response, e *cone.Event, msg proto.Message)) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		msg, err := c.Decode(e)
+		if err != nil {
+			_ = cone.Term(r)
+			return
+		}
+		fn(r, e, msg)
+	})
+}
+
+// Handle returns a handler that decodes events holding a message of the
+// generated type T and passes it to fn. Events holding other messages, or
+// that can not be decoded, are terminated.
+func Handle[T proto.Message](fn func(r cone.Response, e *cone.Event, msg T)) cone.Handler {
+	var zero T
+	mt := zero.ProtoReflect().Type()
+
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		name, err := messageName(e)
+		if err != nil || name != mt.Descriptor().FullName() {
+			_ = cone.Term(r)
+			return
+		}
+
+		msg := mt.New().Interface().(T)
+		if err := proto.Unmarshal(e.Body, msg); err != nil {
+			_ = cone.Term(r)
+			return
+		}
+		fn(r, e, msg)
+	})
+}
+
+func (c *Codec) types() protoregistry.MessageTypeResolver {
+	if c.Types == nil {
+		return protoregistry.GlobalTypes
+	}
+	return c.Types
+}
+
+func messageName(e *cone.Event) (protoreflect.FullName, error) {
+	if name := e.Header.Get(TypeHeader); name != "" {
+		return protoreflect.FullName(name), nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(e.Header.Get("Content-Type"))
+	if err == nil && (mediaType == ContentType || mediaType == "application/x-protobuf") && params["proto"] != "" {
+		return protoreflect.FullName(params["proto"]), nil
+	}
+
+	return "", ErrNoMessageType
+}
@@ -0,0 +1,201 @@
+package protobuf_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/protobuf"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// orderDescriptors describes:
+//
+//	package acme.orders.v1;
+//	message OrderCreated { string id = 1; int64 amount = 2; }
+func orderDescriptors() *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("acme/orders/v1/orders.proto"),
+		Package: proto.String("acme.orders.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("OrderCreated"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+			},
+		}},
+	}}}
+}
+
+func newOrder(t *testing.T, codec *protobuf.Codec) proto.Message {
+	mt, err := codec.Types.FindMessageByName("acme.orders.v1.OrderCreated")
+	if err != nil {
+		t.Fatalf("Expected order type to be registered but got %v", err)
+	}
+
+	msg := mt.New()
+	msg.Set(mt.Descriptor().Fields().ByName("id"), protoreflect.ValueOfString("o-1"))
+	msg.Set(mt.Descriptor().Fields().ByName("amount"), protoreflect.ValueOfInt64(42))
+	return msg.Interface()
+}
+
+func TestCodec(t *testing.T) {
+	t.Run("Generated types", func(t *testing.T) {
+		codec := &protobuf.Codec{}
+		e, err := codec.Encode("greetings", wrapperspb.String("hello"))
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if e.Header.Get(protobuf.TypeHeader) != "google.protobuf.StringValue" {
+			t.Fatalf("Expected type header but got %q", e.Header.Get(protobuf.TypeHeader))
+		}
+
+		msg, err := codec.Decode(e)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if msg.(*wrapperspb.StringValue).GetValue() != "hello" {
+			t.Fatalf("Expected decoded message but got %v", msg)
+		}
+	})
+
+	t.Run("Descriptors", func(t *testing.T) {
+		codec, err := protobuf.NewCodecFromDescriptors(orderDescriptors())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		e, err := codec.Encode("orders.created", newOrder(t, codec))
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		msg, err := codec.Decode(e)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if _, ok := msg.(*dynamicpb.Message); !ok {
+			t.Fatalf("Expected dynamic message but got %T", msg)
+		}
+		if !proto.Equal(msg, newOrder(t, codec)) {
+			t.Fatalf("Expected decoded order but got %v", msg)
+		}
+	})
+
+	t.Run("Content-Type parameter", func(t *testing.T) {
+		body, _ := proto.Marshal(wrapperspb.Int64(7))
+		e := conetest.NewEvent("numbers", body)
+		e.Header.Set("Content-Type", "application/x-protobuf; proto=google.protobuf.Int64Value")
+
+		msg, err := (&protobuf.Codec{}).Decode(e)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if msg.(*wrapperspb.Int64Value).GetValue() != 7 {
+			t.Fatalf("Expected decoded message but got %v", msg)
+		}
+	})
+
+	t.Run("No message type", func(t *testing.T) {
+		e := conetest.NewEvent("numbers", nil)
+		e.Header.Set("Content-Type", "application/json")
+
+		_, err := (&protobuf.Codec{}).Decode(e)
+		if !errors.Is(err, protobuf.ErrNoMessageType) {
+			t.Fatalf("Expected ErrNoMessageType but got %v", err)
+		}
+	})
+
+	t.Run("Unknown message type", func(t *testing.T) {
+		e := conetest.NewEvent("numbers", nil)
+		e.Header.Set(protobuf.TypeHeader, "acme.Unknown")
+
+		_, err := (&protobuf.Codec{}).Decode(e)
+		if !errors.Is(err, protobuf.ErrUnknownMessageType) {
+			t.Fatalf("Expected ErrUnknownMessageType but got %v", err)
+		}
+	})
+}
+
+func TestText(t *testing.T) {
+	codec, err := protobuf.NewCodecFromDescriptors(orderDescriptors())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	e, _ := codec.Encode("orders.created", newOrder(t, codec))
+	text, err := codec.Text(e)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	// The text format is not stable, spacing may vary between builds
+	text = strings.Join(strings.Fields(text), " ")
+	expected := `acme.orders.v1.OrderCreated{id:"o-1" amount:42}`
+	if text != expected {
+		t.Fatalf("Expected %q but got %q", expected, text)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	codec := &protobuf.Codec{}
+
+	var got string
+	handler := protobuf.Handle(func(_ cone.Response, _ *cone.Event, msg *wrapperspb.StringValue) {
+		got = msg.GetValue()
+	})
+
+	t.Run("Matching type", func(t *testing.T) {
+		e, _ := codec.Encode("greetings", wrapperspb.String("hello"))
+		r := conetest.NewRecorder()
+		handler.Serve(r, e)
+		if got != "hello" {
+			t.Fatalf("Expected handler to get message but got %q", got)
+		}
+	})
+
+	t.Run("Other type is terminated", func(t *testing.T) {
+		e, _ := codec.Encode("greetings", wrapperspb.Int64(1))
+		r := conetest.NewRecorder()
+		handler.Serve(r, e)
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected Term but got %s", r.Result())
+		}
+	})
+
+	t.Run("Codec handler", func(t *testing.T) {
+		var name protoreflect.FullName
+		h := codec.Handler(func(_ cone.Response, _ *cone.Event, msg proto.Message) {
+			name = msg.ProtoReflect().Descriptor().FullName()
+		})
+
+		e, _ := codec.Encode("greetings", wrapperspb.Int64(1))
+		h.Serve(conetest.NewRecorder(), e)
+		if name != "google.protobuf.Int64Value" {
+			t.Fatalf("Expected Int64Value but got %q", name)
+		}
+
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("greetings", nil))
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected Term but got %s", r.Result())
+		}
+	})
+}
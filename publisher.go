@@ -0,0 +1,29 @@
+package cone
+
+import "context"
+
+// Publisher publishes events, for example to a JetStream stream.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+type PublisherFunc func(context.Context, *Event) error
+
+func (p PublisherFunc) Publish(ctx context.Context, e *Event) error {
+	return p(ctx, e)
+}
+
+// PublisherMiddleware wraps a Publisher with additional behaviour, like
+// compressing or signing events before they are published.
+type PublisherMiddleware func(Publisher) Publisher
+
+// ChainPublisher composes publisher middleware into one. The first middleware
+// is the outermost one, so it sees the event first.
+func ChainPublisher(middleware ...PublisherMiddleware) PublisherMiddleware {
+	return func(p Publisher) Publisher {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			p = middleware[i](p)
+		}
+		return p
+	}
+}
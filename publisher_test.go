@@ -0,0 +1,34 @@
+package cone_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestChainPublisher(t *testing.T) {
+	tag := func(value string) cone.PublisherMiddleware {
+		return func(next cone.Publisher) cone.Publisher {
+			return cone.PublisherFunc(func(ctx context.Context, e *cone.Event) error {
+				e.Header.Add("order", value)
+				return next.Publish(ctx, e)
+			})
+		}
+	}
+
+	p := conetest.NewPublisher()
+	publisher := cone.ChainPublisher(tag("a"), tag("b"))(p)
+	if err := publisher.Publish(context.Background(), conetest.NewEvent("event.subject", nil)); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	events := p.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 published event but got %d", len(events))
+	}
+	if order := events[0].Header.Values("order"); len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Fatalf("Expected middleware to run in order a, b but got %v", order)
+	}
+}
@@ -0,0 +1,236 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zapling/cone"
+)
+
+var _ cone.Throttle = &Limiter{}
+
+// Limit is a token bucket, filled with Rate tokens per second up to Burst.
+// Each event takes a token.
+type Limit struct {
+	// Rate is the number of events per second.
+	Rate float64
+
+	// Burst is the number of events allowed at once. If less than 1, it is 1.
+	Burst int
+
+	// Header, if set, gives each value of the header its own bucket, for
+	// example to limit each tenant separately.
+	Header string
+}
+
+func (l Limit) burst() float64 {
+	return float64(max(l.Burst, 1))
+}
+
+// Limiter limits the rate of events per subject pattern, and globally. Events
+// over the limit wait for it, or are Nak'd with a delay.
+//
+// Set the Limiter as the Throttle of the consumer to keep it from fetching
+// events while events are over the limit. The consumer is then held back as
+// long as any of them, whatever their subject or key, so the other events
+// fetched meanwhile would not wait or be Nak'd either. Delays of at least
+// the ThrottlePause of the consumer also pause a PausableSource, such as the
+// JetStream source, which would otherwise keep pulling messages from the
+// server in the background.
+type Limiter struct {
+	// Global, if set, limits all events, on top of the limits per pattern.
+	Global *Limit
+
+	// Wait makes events over the limit wait for it, rather than be Nak'd.
+	Wait bool
+
+	// MaxWait, if non-zero, is the longest an event waits. Events that would
+	// wait longer are Nak'd with a delay instead.
+	MaxWait time.Duration
+
+	// OnLimited responds to events over the limit that do not wait, with the
+	// delay until the limit allows them. If nil, they are Nak'd with
+	// cone.NakWithDelay.
+	OnLimited func(r cone.Response, e *cone.Event, delay time.Duration)
+
+	mu        sync.Mutex
+	patterns  []string
+	limits    map[string]Limit
+	buckets   map[bucketKey]*bucket
+	nextPrune int
+	throttled time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{}
+}
+
+// Limit limits the events with subjects matching pattern. The most specific
+// matching pattern applies. It panics if pattern is empty or already limited,
+// or if the rate is not positive.
+func (l *Limiter) Limit(pattern string, limit Limit) {
+	if pattern == "" {
+		panic("empty subject is not allowed")
+	}
+	if limit.Rate <= 0 {
+		panic("rate must be positive")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.limits[pattern]; ok {
+		panic("subject " + pattern + " is already limited")
+	}
+	if l.limits == nil {
+		l.limits = make(map[string]Limit)
+	}
+	l.limits[pattern] = limit
+	l.patterns = append(l.patterns, pattern)
+}
+
+// Middleware limits the rate of events passed to next.
+func (l *Limiter) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		delay, reserved := l.reserve(e)
+		if delay > 0 && !reserved {
+			if l.OnLimited != nil {
+				l.OnLimited(r, e, delay)
+				return
+			}
+			_ = cone.NakWithDelay(r, delay)
+			return
+		}
+
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-e.Context().Done():
+				t.Stop()
+				l.cancel(e)
+				_ = r.Nak()
+				return
+			}
+		}
+
+		next.Serve(r, e)
+	})
+}
+
+// Delay returns how long until the events over the limit are allowed, for
+// the consumer to wait before fetching more.
+func (l *Limiter) Delay() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(time.Until(l.throttled), 0)
+}
+
+// reserve takes a token for e from each of its buckets, returning how long
+// until they are available. If e does not wait for them, no tokens are
+// taken, and reserved is false.
+func (l *Limiter) reserve(e *cone.Event) (delay time.Duration, reserved bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	buckets := l.bucketsFor(e, now)
+	for _, b := range buckets {
+		b.refill(now)
+		delay = max(delay, b.delay())
+	}
+
+	reserved = delay == 0 || l.Wait && (l.MaxWait == 0 || delay <= l.MaxWait)
+	if reserved {
+		for _, b := range buckets {
+			b.tokens--
+		}
+	}
+	if until := now.Add(delay); until.After(l.throttled) {
+		l.throttled = until
+	}
+
+	return delay, reserved
+}
+
+// cancel returns the tokens reserved for e.
+func (l *Limiter) cancel(e *cone.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range l.bucketsFor(e, time.Now()) {
+		b.tokens = min(b.tokens+1, b.limit.burst())
+	}
+}
+
+type bucketKey struct {
+	pattern string // empty for the global limit
+	value   string
+}
+
+// bucketsFor returns the buckets limiting e. l.mu must be held.
+func (l *Limiter) bucketsFor(e *cone.Event, now time.Time) []*bucket {
+	var buckets []*bucket
+	if l.Global != nil {
+		buckets = append(buckets, l.bucket("", *l.Global, e, now))
+	}
+	if pattern, ok := cone.MostSpecificPattern(e.Subject, l.patterns); ok {
+		buckets = append(buckets, l.bucket(pattern, l.limits[pattern], e, now))
+	}
+	return buckets
+}
+
+func (l *Limiter) bucket(pattern string, limit Limit, e *cone.Event, now time.Time) *bucket {
+	key := bucketKey{pattern: pattern}
+	if limit.Header != "" {
+		key.value = e.Header.Get(limit.Header)
+	}
+
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+
+	if l.buckets == nil {
+		l.buckets = make(map[bucketKey]*bucket)
+	}
+	if len(l.buckets) >= l.nextPrune {
+		l.prune(now)
+	}
+
+	b := &bucket{limit: limit, tokens: limit.burst(), last: now}
+	l.buckets[key] = b
+	return b
+}
+
+// prune forgets the buckets that have filled up, as new ones are full too,
+// so buckets per header value do not pile up.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.burst() {
+			delete(l.buckets, key)
+		}
+	}
+	l.nextPrune = max(1024, 2*len(l.buckets))
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate, b.limit.burst())
+		b.last = now
+	}
+}
+
+// delay returns how long until the bucket has a token.
+func (b *bucket) delay() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,184 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	ack := cone.HandlerFunc(func(r cone.Response, _ *cone.Event) {
+		_ = r.Ack()
+	})
+
+	t.Run("Events over the limit should be naked with delay", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Limit("event.*", ratelimit.Limit{Rate: 10, Burst: 2})
+		h := l.Middleware(ack)
+
+		for i := 0; i < 2; i++ {
+			r := conetest.NewRecorder()
+			h.Serve(r, conetest.NewEvent("event.subject", nil))
+			if r.Result() != conetest.Ack {
+				t.Fatalf("Expected %s within burst but got %s", conetest.Ack, r.Result())
+			}
+		}
+
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.subject", nil))
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s over the limit but got %s", conetest.Nak, r.Result())
+		}
+		if r.Delay() <= 0 || r.Delay() > 100*time.Millisecond {
+			t.Fatalf("Expected delay of at most 100ms but got %s", r.Delay())
+		}
+		if d := l.Delay(); d <= 0 || d > r.Delay() {
+			t.Fatalf("Expected limiter to throttle for at most %s but got %s", r.Delay(), d)
+		}
+	})
+
+	t.Run("Unlimited subjects should pass", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Limit("event.limited", ratelimit.Limit{Rate: 1})
+		h := l.Middleware(ack)
+
+		for i := 0; i < 5; i++ {
+			r := conetest.NewRecorder()
+			h.Serve(r, conetest.NewEvent("event.other", nil))
+			if r.Result() != conetest.Ack {
+				t.Fatalf("Expected %s but got %s", conetest.Ack, r.Result())
+			}
+		}
+		if d := l.Delay(); d != 0 {
+			t.Fatalf("Expected no throttling but got %s", d)
+		}
+	})
+
+	t.Run("Header values should have their own buckets", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Limit("event.*", ratelimit.Limit{Rate: 1, Header: "tenant"})
+		h := l.Middleware(ack)
+
+		serve := func(tenant string) string {
+			e := conetest.NewEvent("event.subject", nil)
+			e.Header = cone.Header{}
+			e.Header.Set("tenant", tenant)
+			r := conetest.NewRecorder()
+			h.Serve(r, e)
+			return r.Result()
+		}
+
+		if result := serve("a"); result != conetest.Ack {
+			t.Fatalf("Expected %s but got %s", conetest.Ack, result)
+		}
+		if result := serve("b"); result != conetest.Ack {
+			t.Fatalf("Expected %s for another tenant but got %s", conetest.Ack, result)
+		}
+		if result := serve("a"); result != conetest.Nak {
+			t.Fatalf("Expected %s but got %s", conetest.Nak, result)
+		}
+	})
+
+	t.Run("Global limit should apply to all subjects", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Global = &ratelimit.Limit{Rate: 1}
+		h := l.Middleware(ack)
+
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.a", nil))
+		if r.Result() != conetest.Ack {
+			t.Fatalf("Expected %s but got %s", conetest.Ack, r.Result())
+		}
+
+		r = conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.b", nil))
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s but got %s", conetest.Nak, r.Result())
+		}
+	})
+
+	t.Run("Events over the limit should wait", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Wait = true
+		l.Limit("event.subject", ratelimit.Limit{Rate: 50})
+		h := l.Middleware(ack)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			r := conetest.NewRecorder()
+			h.Serve(r, conetest.NewEvent("event.subject", nil))
+			if r.Result() != conetest.Ack {
+				t.Fatalf("Expected %s but got %s", conetest.Ack, r.Result())
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+			t.Fatalf("Expected to wait about 40ms but waited %s", elapsed)
+		}
+	})
+
+	t.Run("Events should not wait longer than MaxWait", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Wait = true
+		l.MaxWait = 10 * time.Millisecond
+		l.Limit("event.subject", ratelimit.Limit{Rate: 1})
+		h := l.Middleware(ack)
+
+		h.Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.subject", nil))
+		if r.Result() != conetest.Nak || r.Delay() <= 0 {
+			t.Fatalf("Expected %s with delay but got %s with %s", conetest.Nak, r.Result(), r.Delay())
+		}
+	})
+
+	t.Run("Waiting should stop when the event context is done", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Wait = true
+		l.Limit("event.subject", ratelimit.Limit{Rate: 1})
+		h := l.Middleware(ack)
+
+		h.Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEventWithContext(ctx, "event.subject", nil))
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected %s but got %s", conetest.Nak, r.Result())
+		}
+	})
+
+	t.Run("OnLimited should respond to limited events", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Limit("event.subject", ratelimit.Limit{Rate: 1})
+		l.OnLimited = func(r cone.Response, _ *cone.Event, _ time.Duration) {
+			_ = cone.Term(r)
+		}
+		h := l.Middleware(ack)
+
+		h.Serve(conetest.NewRecorder(), conetest.NewEvent("event.subject", nil))
+
+		r := conetest.NewRecorder()
+		h.Serve(r, conetest.NewEvent("event.subject", nil))
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected %s but got %s", conetest.Term, r.Result())
+		}
+	})
+
+	t.Run("Limiting a pattern twice should panic", func(t *testing.T) {
+		l := ratelimit.NewLimiter()
+		l.Limit("event.subject", ratelimit.Limit{Rate: 1})
+
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected panic but got none")
+			}
+		}()
+		l.Limit("event.subject", ratelimit.Limit{Rate: 1})
+	})
+}
@@ -0,0 +1,96 @@
+package cone
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+	defaultStopTimeout    = 5 * time.Second
+)
+
+// Transient marks err as transient, signalling to a Consumer with a
+// RestartPolicy that the source can be restarted. Sources should use it for
+// errors they can recover from, such as a lost connection or a deleted
+// server side consumer that might be recreated.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether any error in err's tree has been marked with
+// Transient.
+func IsTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// RestartPolicy configures how a Consumer restarts its source after a
+// transient error. The delay between attempts grows exponentially from
+// InitialBackoff up to MaxBackoff.
+type RestartPolicy struct {
+	// IsTransient classifies source errors. Errors it reports as fatal make
+	// ListenAndConsume return. Defaults to IsTransient.
+	IsTransient func(err error) bool
+
+	// InitialBackoff is the delay before the first restart attempt.
+	// Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between restart attempts. Defaults to 30s.
+	MaxBackoff time.Duration
+
+	// MaxAttempts is the number of consecutive restarts allowed before
+	// giving up and returning the last error. Zero means no limit.
+	MaxAttempts int
+
+	// StopTimeout bounds how long the failed source is given to stop before
+	// it is started again. Defaults to 5s.
+	StopTimeout time.Duration
+}
+
+func (p *RestartPolicy) isTransient(err error) bool {
+	if p.IsTransient != nil {
+		return p.IsTransient(err)
+	}
+	return IsTransient(err)
+}
+
+func (p *RestartPolicy) backoff(attempt int) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	delay := initial
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
+
+func (p *RestartPolicy) stopTimeout() time.Duration {
+	if p.StopTimeout <= 0 {
+		return defaultStopTimeout
+	}
+	return p.StopTimeout
+}
@@ -0,0 +1,125 @@
+package cone_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestTransient(t *testing.T) {
+	t.Run("Nil error stays nil", func(t *testing.T) {
+		if cone.Transient(nil) != nil {
+			t.Fatal("Expected nil error")
+		}
+	})
+
+	t.Run("Wrapped transient error is transient", func(t *testing.T) {
+		base := errors.New("connection lost")
+		err := fmt.Errorf("next: %w", cone.Transient(base))
+		if !cone.IsTransient(err) {
+			t.Fatal("Expected error to be transient")
+		}
+		if !errors.Is(err, base) {
+			t.Fatal("Expected transient error to wrap the original error")
+		}
+	})
+
+	t.Run("Plain error is not transient", func(t *testing.T) {
+		if cone.IsTransient(errors.New("boom")) {
+			t.Fatal("Expected error to not be transient")
+		}
+	})
+}
+
+func TestRestart(t *testing.T) {
+	t.Run("Without policy source errors are returned", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddError(cone.Transient(errors.New("connection lost")))
+		c := cone.New(s, cone.NewHandlerMux())
+
+		err := c.ListenAndConsume()
+		if !cone.IsTransient(err) {
+			t.Fatalf("Expected transient error but got: %v", err)
+		}
+		if c.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+		}
+	})
+
+	t.Run("Transient errors restart the source", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddError(cone.Transient(errors.New("connection lost")))
+		s.AddError(cone.Transient(errors.New("connection lost")))
+		s.AddError(errors.New("fatal"))
+
+		var mu sync.Mutex
+		var transitions []string
+		c := cone.New(s, cone.NewHandlerMux())
+		c.Restart = &cone.RestartPolicy{InitialBackoff: time.Millisecond}
+		c.OnStateChange = func(from, to cone.State) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, fmt.Sprintf("%s->%s", from, to))
+		}
+
+		err := c.ListenAndConsume()
+		if err == nil || err.Error() != "fatal" {
+			t.Fatalf("Expected fatal error but got: %v", err)
+		}
+
+		if s.NumStarts() != 3 {
+			t.Fatalf("Expected source to be started 3 times, got %d", s.NumStarts())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		expected := []string{
+			"idle->running",
+			"running->restarting", "restarting->running",
+			"running->restarting", "restarting->running",
+			"running->stopped",
+		}
+		if fmt.Sprint(transitions) != fmt.Sprint(expected) {
+			t.Fatalf("Expected transitions %v but got %v", expected, transitions)
+		}
+	})
+
+	t.Run("Gives up after max attempts", func(t *testing.T) {
+		s := conetest.NewSource()
+		for i := 0; i < 5; i++ {
+			s.AddError(cone.Transient(errors.New("connection lost")))
+		}
+		c := cone.New(s, cone.NewHandlerMux())
+		c.Restart = &cone.RestartPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 2}
+
+		err := c.ListenAndConsume()
+		if !cone.IsTransient(err) {
+			t.Fatalf("Expected transient error but got: %v", err)
+		}
+		if s.NumStarts() != 3 {
+			t.Fatalf("Expected source to be started 3 times, got %d", s.NumStarts())
+		}
+	})
+
+	t.Run("Custom classifier", func(t *testing.T) {
+		errRetry := errors.New("retry me")
+		s := conetest.NewSource()
+		s.AddError(errRetry)
+		s.AddError(errors.New("fatal"))
+		c := cone.New(s, cone.NewHandlerMux())
+		c.Restart = &cone.RestartPolicy{
+			InitialBackoff: time.Millisecond,
+			IsTransient:    func(err error) bool { return errors.Is(err, errRetry) },
+		}
+
+		_ = c.ListenAndConsume()
+		if s.NumStarts() != 2 {
+			t.Fatalf("Expected source to be started 2 times, got %d", s.NumStarts())
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package cone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrOverlappingSubjects = errors.New("overlapping subjects")
+)
+
+// Route describes a route registered on a HandlerMux.
+type Route struct {
+	// Subject is the full subject the route handles.
+	Subject string `json:"subject"`
+
+	// Headers lists the header predicates of routes registered with
+	// HandleMatch, as "key=value".
+	Headers []string `json:"headers,omitempty"`
+
+	// Handler is the name of the handler function, or the type of the
+	// handler for other handlers.
+	Handler string `json:"handler"`
+
+	// Middleware lists the names of the middleware wrapping the handler,
+	// outermost first.
+	Middleware []string `json:"middleware,omitempty"`
+}
+
+// Routes returns the routes registered on the mux, including the routes of
+// mounted muxes, sorted by subject.
+func (h *HandlerMux) Routes() []Route {
+	routes := h.root().routes("", nil)
+	slices.SortStableFunc(routes, func(a, b Route) int {
+		return strings.Compare(a.Subject, b.Subject)
+	})
+	return routes
+}
+
+// routes lists the routes of h with subjects under prefix, wrapped by the
+// outer middleware.
+func (h *HandlerMux) routes(prefix string, outer []string) []Route {
+	var routes []Route
+	seen := make(map[string]bool)
+
+	for subject, entry := range h.handlers {
+		subject = joinSubject(prefix, subject)
+		seen[subject] = true
+		routes = append(routes, Route{
+			Subject:    subject,
+			Handler:    handlerName(entry.handler),
+			Middleware: slices.Concat(outer, entry.mux.middlewareNames()),
+		})
+	}
+
+	for _, m := range h.matches {
+		var headers []string
+		for _, header := range m.matcher.headers {
+			headers = append(headers, header.key+"="+header.value)
+		}
+		routes = append(routes, Route{
+			Subject:    joinSubject(prefix, m.matcher.subject),
+			Headers:    headers,
+			Handler:    handlerName(m.handler),
+			Middleware: slices.Concat(outer, m.mux.middlewareNames()),
+		})
+	}
+
+	for _, m := range h.mounts {
+		mounted := m.mux.routes(joinSubject(prefix, m.prefix), slices.Concat(outer, m.at.middlewareNames()))
+		for _, route := range mounted {
+			// Routes registered directly take precedence
+			if !seen[route.Subject] {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes
+}
+
+// middlewareNames returns the names of the middleware of h and its parents,
+// outermost first.
+func (h *HandlerMux) middlewareNames() []string {
+	var names []string
+	for mux := h; mux != nil; mux = mux.parent {
+		scope := make([]string, 0, len(mux.middleware))
+		for _, mw := range mux.middleware {
+			scope = append(scope, funcName(mw))
+		}
+		names = append(scope, names...)
+	}
+	return names
+}
+
+func handlerName(h Handler) string {
+	switch h := h.(type) {
+	case nil:
+		return "<nil>"
+	case HandlerFunc:
+		return funcName(h)
+	case ErrHandlerFunc:
+		return funcName(h)
+	default:
+		return fmt.Sprintf("%T", h)
+	}
+}
+
+func funcName(f any) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "<nil>"
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return "<unknown>"
+}
+
+// WriteRoutesJSON writes routes to w as a JSON array.
+func WriteRoutesJSON(w io.Writer, routes []Route) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(routes)
+}
+
+// WriteRoutesMarkdown writes routes to w as a Markdown table.
+func WriteRoutesMarkdown(w io.Writer, routes []Route) error {
+	var b strings.Builder
+	b.WriteString("| Subject | Headers | Handler | Middleware |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, route := range routes {
+		fmt.Fprintf(&b, "| `%s` | %s | `%s` | %s |\n",
+			route.Subject,
+			markdownList(route.Headers),
+			route.Handler,
+			markdownList(route.Middleware),
+		)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// FilterSubjects returns the subjects of routes suitable as the
+// FilterSubjects of a JetStream consumer. Duplicates and subjects covered by
+// a wildcard of another route are left out, as JetStream does not allow
+// overlapping filters. Subjects that overlap without one covering the other,
+// such as "orders.*.created" and "orders.eu.>", cannot be left out and
+// return ErrOverlappingSubjects.
+func FilterSubjects(routes []Route) ([]string, error) {
+	var subjects []string
+	for _, route := range routes {
+		covered := slices.ContainsFunc(routes, func(other Route) bool {
+			return other.Subject != route.Subject && SubjectCovers(other.Subject, route.Subject)
+		})
+		if !covered && !slices.Contains(subjects, route.Subject) {
+			subjects = append(subjects, route.Subject)
+		}
+	}
+	slices.Sort(subjects)
+
+	if err := CheckFilterSubjects(subjects); err != nil {
+		return nil, err
+	}
+	return subjects, nil
+}
+
+// CheckFilterSubjects returns ErrOverlappingSubjects if two of subjects can
+// match the same subject, which JetStream does not allow for the
+// FilterSubjects of a consumer.
+func CheckFilterSubjects(subjects []string) error {
+	for i, a := range subjects {
+		for _, b := range subjects[i+1:] {
+			if SubjectsOverlap(a, b) {
+				return fmt.Errorf("%w: %s and %s", ErrOverlappingSubjects, a, b)
+			}
+		}
+	}
+	return nil
+}
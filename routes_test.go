@@ -0,0 +1,151 @@
+package cone_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zapling/cone"
+)
+
+func invoiceCreated(_ cone.Response, _ *cone.Event) {}
+
+type orderHandler struct{}
+
+func (orderHandler) Serve(_ cone.Response, _ *cone.Event) {}
+
+func logging(next cone.Handler) cone.Handler { return next }
+
+func authorize(next cone.Handler) cone.Handler { return next }
+
+func newRoutesMux() *cone.HandlerMux {
+	billing := cone.NewHandlerMux()
+	billing.HandleFunc("invoice.created", invoiceCreated)
+
+	h := cone.NewHandlerMux()
+	h.Use(logging)
+	h.Handle("orders.>", orderHandler{})
+	h.With(authorize).Handle("orders.created", orderHandler{})
+	h.Mount("billing.v1", billing)
+	return h
+}
+
+func TestRoutes(t *testing.T) {
+	routes := newRoutesMux().Routes()
+
+	expected := []cone.Route{
+		{
+			Subject:    "billing.v1.invoice.created",
+			Handler:    "github.com/zapling/cone_test.invoiceCreated",
+			Middleware: []string{"github.com/zapling/cone_test.logging"},
+		},
+		{
+			Subject:    "orders.>",
+			Handler:    "cone_test.orderHandler",
+			Middleware: []string{"github.com/zapling/cone_test.logging"},
+		},
+		{
+			Subject:    "orders.created",
+			Handler:    "cone_test.orderHandler",
+			Middleware: []string{"github.com/zapling/cone_test.logging", "github.com/zapling/cone_test.authorize"},
+		},
+	}
+
+	if fmt.Sprint(routes) != fmt.Sprint(expected) {
+		t.Fatalf("Expected routes\n%v\nbut got\n%v", expected, routes)
+	}
+}
+
+func TestRoutesWithHeaders(t *testing.T) {
+	h := cone.NewHandlerMux()
+	h.HandleMatch(cone.Subject("orders.>").Header("type", "created"), orderHandler{})
+
+	routes := h.Routes()
+	if len(routes) != 1 {
+		t.Fatalf("Expected 1 route but got %v", routes)
+	}
+	if fmt.Sprint(routes[0].Headers) != "[type=created]" {
+		t.Fatalf("Expected headers [type=created] but got %v", routes[0].Headers)
+	}
+}
+
+func TestWriteRoutesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := cone.WriteRoutesJSON(&buf, newRoutesMux().Routes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	var routes []cone.Route
+	if err := json.Unmarshal(buf.Bytes(), &routes); err != nil {
+		t.Fatalf("Failed to decode routes: %s", err.Error())
+	}
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes but got %d", len(routes))
+	}
+}
+
+func TestWriteRoutesMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := cone.WriteRoutesMarkdown(&buf, newRoutesMux().Routes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected header and 3 rows but got:\n%s", buf.String())
+	}
+	if lines[3] != "| `orders.>` |  | `cone_test.orderHandler` | `github.com/zapling/cone_test.logging` |" {
+		t.Fatalf("Unexpected row: %s", lines[3])
+	}
+}
+
+func TestFilterSubjects(t *testing.T) {
+	t.Run("Covered subjects should be left out", func(t *testing.T) {
+		subjects, err := cone.FilterSubjects(newRoutesMux().Routes())
+		if err != nil {
+			t.Fatalf("Expected no error but got %s", err)
+		}
+		expected := []string{"billing.v1.invoice.created", "orders.>"}
+		if fmt.Sprint(subjects) != fmt.Sprint(expected) {
+			t.Fatalf("Expected subjects %v but got %v", expected, subjects)
+		}
+	})
+
+	t.Run("Partially overlapping subjects should error", func(t *testing.T) {
+		handler := func(_ cone.Response, _ *cone.Event) {}
+		h := cone.NewHandlerMux()
+		h.HandleFunc("orders.*.created", handler)
+		h.HandleFunc("orders.eu.>", handler)
+		h.HandleFunc("billing.created", handler)
+
+		_, err := cone.FilterSubjects(h.Routes())
+		if !errors.Is(err, cone.ErrOverlappingSubjects) {
+			t.Fatalf("Expected ErrOverlappingSubjects but got %v", err)
+		}
+	})
+}
+
+func TestCheckFilterSubjects(t *testing.T) {
+	tests := []struct {
+		subjects []string
+		overlap  bool
+	}{
+		{[]string{"orders.created", "orders.paid"}, false},
+		{[]string{"orders.*", "billing.>"}, false},
+		{[]string{"orders.>", "orders.created"}, true},
+		{[]string{"orders.*.created", "orders.eu.>"}, true},
+		{[]string{"orders.created", "orders.created"}, true},
+	}
+
+	for _, tt := range tests {
+		err := cone.CheckFilterSubjects(tt.subjects)
+		if errors.Is(err, cone.ErrOverlappingSubjects) != tt.overlap {
+			t.Fatalf("%v: Expected overlap %t but got %v", tt.subjects, tt.overlap, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultGracePeriod = 30 * time.Second
+
+// RunOptions configures Run and RunGroup. The zero value is ready to use.
+type RunOptions struct {
+	// GracePeriod is how long in-flight handlers are given to finish once a
+	// shutdown has been triggered. Defaults to 30s.
+	GracePeriod time.Duration
+
+	// Signals that trigger a graceful shutdown. Defaults to SIGINT and
+	// SIGTERM.
+	Signals []os.Signal
+}
+
+func (o RunOptions) gracePeriod() time.Duration {
+	if o.GracePeriod <= 0 {
+		return defaultGracePeriod
+	}
+	return o.GracePeriod
+}
+
+func (o RunOptions) signals() []os.Signal {
+	if len(o.Signals) == 0 {
+		return []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return o.Signals
+}
+
+// Run runs the consumer until ctx is done or one of the configured signals
+// is received, and then shuts it down gracefully. The returned error joins
+// the error from consuming, if it stopped for any other reason than being
+// shut down, with the error from shutting down.
+func Run(ctx context.Context, consumer *Consumer, opts RunOptions) error {
+	return RunGroup(ctx, []*Consumer{consumer}, opts)
+}
+
+// RunGroup is like Run but runs several consumers together. If any of them
+// stops with an error, the others are shut down as well.
+func RunGroup(ctx context.Context, consumers []*Consumer, opts RunOptions) error {
+	if len(consumers) == 0 {
+		return fmt.Errorf("no consumers to run")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, opts.signals()...)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	consumeErrs := make([]error, len(consumers))
+	running := make([]bool, len(consumers))
+	for i, c := range consumers {
+		var once sync.Once
+		started := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.listenAndConsume(func(ok bool) {
+				once.Do(func() {
+					running[i] = ok
+					close(started)
+				})
+			})
+			if !errors.Is(err, ErrConsumerStopped) {
+				consumeErrs[i] = fmt.Errorf("consume: %w", err)
+				cancel()
+			}
+		}()
+		<-started
+	}
+
+	<-ctx.Done()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), opts.gracePeriod())
+	defer cancelShutdown()
+
+	shutdownErrs := make([]error, len(consumers))
+	for i, c := range consumers {
+		// Consumers that did not start here, such as ones already running
+		// elsewhere, are not ours to shut down
+		if !running[i] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Shutdown(shutdownCtx)
+			// Consumers that are not running have failed by themselves
+			if err != nil && !errors.Is(err, errNotRunning) {
+				shutdownErrs[i] = fmt.Errorf("shutdown: %w", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var errs []error
+	for i := range consumers {
+		err := errors.Join(consumeErrs[i], shutdownErrs[i])
+		if err != nil && len(consumers) > 1 {
+			err = fmt.Errorf("consumer %d: %w", i, err)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
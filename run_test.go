@@ -0,0 +1,180 @@
+package cone_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("Cancelled context shuts down gracefully", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			time.Sleep(20 * time.Millisecond)
+			_ = r.Ack()
+		}
+		c := cone.New(s, handler)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := cone.Run(ctx, c, cone.RunOptions{})
+		if err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+		if s.NumAckd() != 1 {
+			t.Fatalf("Expected 1 acked message, but got: %d", s.NumAckd())
+		}
+		if c.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+		}
+	})
+
+	t.Run("Configured signal shuts down gracefully", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		started := make(chan struct{})
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			_ = r.Ack()
+		}
+		c := cone.New(s, handler)
+
+		done := make(chan error)
+		go func() {
+			done <- cone.Run(context.Background(), c, cone.RunOptions{Signals: []os.Signal{syscall.SIGUSR1}})
+		}()
+
+		<-started
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatalf("Expected nil but got err: %s", err.Error())
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Expected nil but got err: %s", err.Error())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Run never returned")
+		}
+
+		if s.NumAckd() != 1 {
+			t.Fatalf("Expected 1 acked message, but got: %d", s.NumAckd())
+		}
+		if c.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c.State())
+		}
+	})
+
+	t.Run("Consume error is returned", func(t *testing.T) {
+		errFatal := errors.New("fatal")
+		s := conetest.NewSource()
+		s.AddError(errFatal)
+		c := cone.New(s, cone.NewHandlerMux())
+
+		err := cone.Run(context.Background(), c, cone.RunOptions{})
+		if !errors.Is(err, errFatal) {
+			t.Fatalf("Expected fatal error but got: %v", err)
+		}
+	})
+
+	t.Run("Expired grace period is returned", func(t *testing.T) {
+		s := conetest.NewSource()
+		s.AddEvent(conetest.NewEvent("event.subject", nil))
+		release := make(chan struct{})
+		defer close(release)
+		var handler cone.HandlerFunc = func(r cone.Response, _ *cone.Event) {
+			<-release
+		}
+		c := cone.New(s, handler)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := cone.Run(ctx, c, cone.RunOptions{GracePeriod: 10 * time.Millisecond})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected deadline exceeded but got: %v", err)
+		}
+	})
+}
+
+func TestRunGroup(t *testing.T) {
+	t.Run("No consumers should error", func(t *testing.T) {
+		err := cone.RunGroup(context.Background(), nil, cone.RunOptions{})
+		if err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+	})
+
+	t.Run("Failing consumer stops the others", func(t *testing.T) {
+		errFatal := errors.New("fatal")
+		failing := conetest.NewSource()
+		healthy := conetest.NewSource()
+		c1 := cone.New(healthy, cone.NewHandlerMux())
+		c2 := cone.New(failing, cone.NewHandlerMux())
+
+		done := make(chan error)
+		go func() {
+			done <- cone.RunGroup(context.Background(), []*cone.Consumer{c1, c2}, cone.RunOptions{})
+		}()
+
+		time.Sleep(5 * time.Millisecond)
+		failing.AddError(errFatal)
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, errFatal) {
+				t.Fatalf("Expected fatal error but got: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("RunGroup never returned")
+		}
+
+		if c1.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, c1.State())
+		}
+		if healthy.IsRunning() {
+			t.Fatal("Expected source to be stopped")
+		}
+	})
+
+	t.Run("Consumer running elsewhere is not shut down", func(t *testing.T) {
+		source := conetest.NewSource()
+		elsewhere := cone.New(source, cone.NewHandlerMux())
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			_ = elsewhere.ListenAndConsume()
+		}()
+		time.Sleep(5 * time.Millisecond)
+		defer func() {
+			_ = elsewhere.Close()
+			<-stopped
+		}()
+
+		other := cone.New(conetest.NewSource(), cone.NewHandlerMux())
+		err := cone.RunGroup(context.Background(), []*cone.Consumer{other, elsewhere}, cone.RunOptions{})
+		if err == nil {
+			t.Fatal("Expected error but got nil")
+		}
+
+		if elsewhere.State() != cone.StateRunning {
+			t.Fatalf("Expected state %s but got %s", cone.StateRunning, elsewhere.State())
+		}
+		if !source.IsRunning() {
+			t.Fatal("Expected source to still be running")
+		}
+		if other.State() != cone.StateStopped {
+			t.Fatalf("Expected state %s but got %s", cone.StateStopped, other.State())
+		}
+	})
+}
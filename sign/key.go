@@ -0,0 +1,108 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/nats-io/nkeys"
+)
+
+// Signature algorithms, as given in the AlgorithmHeader.
+const (
+	HMACSHA256 = "hmac-sha256"
+	Ed25519    = "ed25519"
+)
+
+// Key signs and verifies signatures.
+type Key interface {
+	// ID identifies the key to the verifier.
+	ID() string
+
+	// Algorithm is the signature algorithm of the key.
+	Algorithm() string
+
+	// Sign returns the signature of data. Keys that can only verify return
+	// an error.
+	Sign(data []byte) ([]byte, error)
+
+	// Verify reports whether signature is a valid signature of data.
+	Verify(data, signature []byte) bool
+}
+
+type hmacKey struct {
+	id     string
+	secret []byte
+}
+
+// HMACKey returns a key signing with HMAC-SHA256 using a secret shared
+// between signer and verifier.
+func HMACKey(id string, secret []byte) Key {
+	if id == "" {
+		panic("empty key id is not allowed")
+	}
+	if len(secret) == 0 {
+		panic("empty secret is not allowed")
+	}
+	return &hmacKey{id: id, secret: secret}
+}
+
+func (k *hmacKey) ID() string {
+	return k.id
+}
+
+func (k *hmacKey) Algorithm() string {
+	return HMACSHA256
+}
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+type nkey struct {
+	id string
+	kp nkeys.KeyPair
+}
+
+// NKey returns a key signing with Ed25519 using an nkey. Its ID is the
+// public key. A key pair from nkeys.FromPublicKey can only verify.
+func NKey(kp nkeys.KeyPair) (Key, error) {
+	public, err := kp.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key: %w", err)
+	}
+	return &nkey{id: public, kp: kp}, nil
+}
+
+// NKeyFromPublicKey returns a key verifying Ed25519 signatures of the nkey
+// with the given public key, like "UABC...".
+func NKeyFromPublicKey(public string) (Key, error) {
+	kp, err := nkeys.FromPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return NKey(kp)
+}
+
+func (k *nkey) ID() string {
+	return k.id
+}
+
+func (k *nkey) Algorithm() string {
+	return Ed25519
+}
+
+func (k *nkey) Sign(data []byte) ([]byte, error) {
+	return k.kp.Sign(data)
+}
+
+func (k *nkey) Verify(data, signature []byte) bool {
+	return k.kp.Verify(data, signature) == nil
+}
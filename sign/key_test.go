@@ -0,0 +1,57 @@
+package sign_test
+
+import (
+	"testing"
+
+	"github.com/nats-io/nkeys"
+	"github.com/zapling/cone/sign"
+)
+
+func TestHMACKey(t *testing.T) {
+	key := sign.HMACKey("partner", []byte("secret"))
+
+	signature, err := key.Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if !key.Verify([]byte("data"), signature) {
+		t.Fatalf("Expected signature to verify")
+	}
+	if sign.HMACKey("partner", []byte("other")).Verify([]byte("data"), signature) {
+		t.Fatalf("Expected signature of another secret not to verify")
+	}
+}
+
+func TestNKey(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("Failed to create nkey: %s", err.Error())
+	}
+	key, err := sign.NKey(kp)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	signature, err := key.Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	public, err := sign.NKeyFromPublicKey(key.ID())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if !public.Verify([]byte("data"), signature) {
+		t.Fatalf("Expected signature to verify with the public key")
+	}
+	if public.Verify([]byte("other"), signature) {
+		t.Fatalf("Expected signature not to verify other data")
+	}
+	if _, err := public.Sign([]byte("data")); err == nil {
+		t.Fatalf("Expected public key not to sign")
+	}
+
+	if _, err := sign.NKeyFromPublicKey("not a key"); err == nil {
+		t.Fatalf("Expected invalid public key to fail")
+	}
+}
@@ -0,0 +1,166 @@
+package sign
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/zapling/cone"
+)
+
+const (
+	// SignatureHeader holds the signature, base64 encoded.
+	SignatureHeader = "signature"
+
+	// KeyIDHeader holds the ID of the key the event was signed with.
+	KeyIDHeader = "signature-key-id"
+
+	// AlgorithmHeader holds the signature algorithm.
+	AlgorithmHeader = "signature-algorithm"
+
+	// SignedHeadersHeader lists the headers covered by the signature,
+	// separated by commas.
+	SignedHeadersHeader = "signature-headers"
+)
+
+var (
+	ErrNotSigned        = errors.New("event is not signed")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Signer signs published events over their subject, body and Headers.
+type Signer struct {
+	Key Key
+
+	// Headers to include in the signature, so they can not be changed
+	// without invalidating it.
+	Headers []string
+}
+
+// Publisher returns a publisher signing events before passing them to next.
+func (s *Signer) Publisher(next cone.Publisher) cone.Publisher {
+	return cone.PublisherFunc(func(ctx context.Context, e *cone.Event) error {
+		signed, err := s.Sign(e)
+		if err != nil {
+			return err
+		}
+		return next.Publish(ctx, signed)
+	})
+}
+
+// Sign returns a copy of e with the signature headers set.
+func (s *Signer) Sign(e *cone.Event) (*cone.Event, error) {
+	signature, err := s.Key.Sign(payload(e, s.Headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign %s: %w", e.Subject, err)
+	}
+
+	signed := e.WithContext(e.Context())
+	signed.Header = maps.Clone(e.Header)
+	if signed.Header == nil {
+		signed.Header = make(cone.Header)
+	}
+	signed.Header.Set(SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	signed.Header.Set(KeyIDHeader, s.Key.ID())
+	signed.Header.Set(AlgorithmHeader, s.Key.Algorithm())
+	if len(s.Headers) > 0 {
+		signed.Header.Set(SignedHeadersHeader, strings.Join(s.Headers, ","))
+	}
+
+	return signed, nil
+}
+
+// Verifier verifies the signatures of events.
+type Verifier struct {
+	// Keys accepted for signatures.
+	Keys []Key
+
+	// Headers that must be covered by the signature.
+	Headers []string
+
+	// OnInvalid responds to events without a valid signature. If nil, they
+	// are terminated with cone.Term.
+	OnInvalid func(r cone.Response, e *cone.Event, err error)
+}
+
+// Middleware verifies events before passing them to next.
+func (v *Verifier) Middleware(next cone.Handler) cone.Handler {
+	return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+		if err := v.Verify(e); err != nil {
+			if v.OnInvalid != nil {
+				v.OnInvalid(r, e, err)
+				return
+			}
+			_ = cone.Term(r)
+			return
+		}
+		next.Serve(r, e)
+	})
+}
+
+// Verify checks that e is signed with one of Keys, and that the signature
+// covers the subject, body and Headers of e.
+func (v *Verifier) Verify(e *cone.Event) error {
+	encoded := e.Header.Get(SignatureHeader)
+	if encoded == "" {
+		return ErrNotSigned
+	}
+
+	id, algorithm := e.Header.Get(KeyIDHeader), e.Header.Get(AlgorithmHeader)
+	i := slices.IndexFunc(v.Keys, func(k Key) bool {
+		return k.ID() == id && k.Algorithm() == algorithm
+	})
+	if i < 0 {
+		return fmt.Errorf("%w %q (%s)", ErrUnknownKey, id, algorithm)
+	}
+
+	var signedHeaders []string
+	if value := e.Header.Get(SignedHeadersHeader); value != "" {
+		signedHeaders = strings.Split(value, ",")
+	}
+	for _, header := range v.Headers {
+		if !slices.Contains(signedHeaders, header) {
+			return fmt.Errorf("%w: header %s is not signed", ErrInvalidSignature, header)
+		}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	if !v.Keys[i].Verify(payload(e, signedHeaders), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// payload returns the data signed for e: its subject, the values of the
+// headers and its body, each prefixed with its length so the boundaries
+// between them are unambiguous.
+func payload(e *cone.Event, headers []string) []byte {
+	var b []byte
+	add := func(s []byte) {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+
+	add([]byte(e.Subject))
+	for _, header := range headers {
+		add([]byte(header))
+		values := e.Header.Values(header)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(values)))
+		for _, value := range values {
+			add([]byte(value))
+		}
+	}
+	add(e.Body)
+
+	return b
+}
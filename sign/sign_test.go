@@ -0,0 +1,132 @@
+package sign_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/sign"
+)
+
+func newEvent() *cone.Event {
+	e := conetest.NewEvent("partner.orders.created", []byte(`{"id": "1"}`))
+	e.Header.Set("type", "created")
+	return e
+}
+
+func TestSignVerify(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("Failed to create nkey: %s", err.Error())
+	}
+	nkey, _ := sign.NKey(kp)
+	public, _ := sign.NKeyFromPublicKey(nkey.ID())
+
+	keys := []struct {
+		name     string
+		signing  sign.Key
+		verifies sign.Key
+	}{
+		{name: "HMAC", signing: sign.HMACKey("partner", []byte("secret")), verifies: sign.HMACKey("partner", []byte("secret"))},
+		{name: "Ed25519", signing: nkey, verifies: public},
+	}
+
+	for _, key := range keys {
+		t.Run(key.name, func(t *testing.T) {
+			signer := &sign.Signer{Key: key.signing, Headers: []string{"type"}}
+			verifier := &sign.Verifier{Keys: []sign.Key{key.verifies}, Headers: []string{"type"}}
+
+			signed, err := signer.Sign(newEvent())
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if err := verifier.Verify(signed); err != nil {
+				t.Fatalf("Expected signature to verify but got %v", err)
+			}
+
+			tampered := []struct {
+				name   string
+				tamper func(e *cone.Event)
+			}{
+				{name: "Subject", tamper: func(e *cone.Event) { e.Subject = "partner.orders.deleted" }},
+				{name: "Body", tamper: func(e *cone.Event) { e.Body = []byte(`{"id": "2"}`) }},
+				{name: "Signed header", tamper: func(e *cone.Event) { e.Header.Set("type", "deleted") }},
+			}
+
+			for _, tt := range tampered {
+				t.Run("Tampered "+tt.name, func(t *testing.T) {
+					e, _ := signer.Sign(newEvent())
+					tt.tamper(e)
+					if err := verifier.Verify(e); !errors.Is(err, sign.ErrInvalidSignature) {
+						t.Fatalf("Expected ErrInvalidSignature but got %v", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := sign.HMACKey("partner", []byte("secret"))
+	verifier := &sign.Verifier{Keys: []sign.Key{key}, Headers: []string{"type"}}
+
+	t.Run("Not signed", func(t *testing.T) {
+		if err := verifier.Verify(newEvent()); !errors.Is(err, sign.ErrNotSigned) {
+			t.Fatalf("Expected ErrNotSigned but got %v", err)
+		}
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		e, _ := (&sign.Signer{Key: sign.HMACKey("other", []byte("secret")), Headers: []string{"type"}}).Sign(newEvent())
+		if err := verifier.Verify(e); !errors.Is(err, sign.ErrUnknownKey) {
+			t.Fatalf("Expected ErrUnknownKey but got %v", err)
+		}
+	})
+
+	t.Run("Required header not signed", func(t *testing.T) {
+		e, _ := (&sign.Signer{Key: key}).Sign(newEvent())
+		if err := verifier.Verify(e); !errors.Is(err, sign.ErrInvalidSignature) {
+			t.Fatalf("Expected ErrInvalidSignature but got %v", err)
+		}
+	})
+
+	t.Run("Unsigned headers can change", func(t *testing.T) {
+		e, _ := (&sign.Signer{Key: key, Headers: []string{"type"}}).Sign(newEvent())
+		e.Header.Set("trace", "abc")
+		if err := verifier.Verify(e); err != nil {
+			t.Fatalf("Expected signature to verify but got %v", err)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	key := sign.HMACKey("partner", []byte("secret"))
+
+	p := conetest.NewPublisher()
+	publisher := (&sign.Signer{Key: key}).Publisher(p)
+	if err := publisher.Publish(context.Background(), newEvent()); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	called := 0
+	handler := (&sign.Verifier{Keys: []sign.Key{key}}).Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+		called++
+	}))
+
+	handler.Serve(conetest.NewRecorder(), p.Events()[0])
+	if called != 1 {
+		t.Fatalf("Expected handler to be called for signed event")
+	}
+
+	r := conetest.NewRecorder()
+	handler.Serve(r, newEvent())
+	if called != 1 {
+		t.Fatalf("Expected handler not to be called for unsigned event")
+	}
+	if r.Result() != conetest.Term {
+		t.Fatalf("Expected Term but got %s", r.Result())
+	}
+}
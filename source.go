@@ -1,9 +1,49 @@
 package cone
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Source interface {
 	Start() error
 	Stop(ctx context.Context) error
 	Next() (Response, *Event, error)
 }
+
+// PausableSource is implemented by sources that can stop fetching events from
+// the server while the consumer is paused. Pause and Resume are only called
+// while the source is running. Stop may be called on a paused source, and
+// Start must start it unpaused.
+type PausableSource interface {
+	Source
+	Pause() error
+	Resume() error
+}
+
+// Throttle is implemented by middleware that wants the consumer to hold back
+// fetching events from the source, such as a rate limiter, so events are not
+// fetched only to be Nak'd or kept waiting. A PausableSource is paused for
+// delays of at least Consumer.ThrottlePause, as it may otherwise keep
+// fetching events in the background.
+type Throttle interface {
+	// Delay returns how long the consumer should wait before fetching the
+	// next event.
+	Delay() time.Duration
+}
+
+// MultiThrottle returns a Throttle that waits for the longest delay of
+// throttles.
+func MultiThrottle(throttles ...Throttle) Throttle {
+	return multiThrottle(throttles)
+}
+
+type multiThrottle []Throttle
+
+func (m multiThrottle) Delay() time.Duration {
+	var delay time.Duration
+	for _, t := range m {
+		delay = max(delay, t.Delay())
+	}
+	return delay
+}
@@ -0,0 +1,65 @@
+package cone
+
+import "strings"
+
+// SubjectCovers reports whether every subject matched by the pattern sub is
+// also matched by pattern. Patterns use NATS wildcards: "*" matches a single
+// token and ">" matches one or more trailing tokens. For a subject without
+// wildcards it reports whether pattern matches it.
+func SubjectCovers(pattern, sub string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subTokens := strings.Split(sub, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subTokens) > i
+		}
+		if i >= len(subTokens) || subTokens[i] == ">" {
+			return false
+		}
+		if token != "*" && token != subTokens[i] {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subTokens)
+}
+
+// SubjectsOverlap reports whether some subject is matched by both patterns a
+// and b.
+func SubjectsOverlap(a, b string) bool {
+	aTokens := strings.Split(a, ".")
+	bTokens := strings.Split(b, ".")
+
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if aTokens[i] == ">" || bTokens[i] == ">" {
+			return true
+		}
+		if aTokens[i] != "*" && bTokens[i] != "*" && aTokens[i] != bTokens[i] {
+			return false
+		}
+	}
+
+	return len(aTokens) == len(bTokens)
+}
+
+// MostSpecificPattern returns the most specific of patterns matching
+// subject, in the order HandlerMux tries wildcard routes. Patterns that are
+// equally specific are ordered by name.
+func MostSpecificPattern(subject string, patterns []string) (string, bool) {
+	var best string
+	found := false
+	for _, pattern := range patterns {
+		if !matchSubject(pattern, subject) {
+			continue
+		}
+		if !found {
+			best, found = pattern, true
+			continue
+		}
+		if c := compareSpecificity(pattern, best); c < 0 || c == 0 && pattern < best {
+			best = pattern
+		}
+	}
+	return best, found
+}
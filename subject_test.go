@@ -0,0 +1,86 @@
+package cone_test
+
+import (
+	"testing"
+
+	"github.com/zapling/cone"
+)
+
+func TestSubjectCovers(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		sub      string
+		expected bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.deleted", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.v1", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.created.v1", true},
+		{"orders.>", "orders", false},
+		{"*.created", "orders.created", true},
+		{"orders.>", "orders.*", true},
+		{"orders.*", "orders.>", false},
+		{"orders.created", "orders.*", false},
+		{">", "orders.created", true},
+	}
+
+	for _, tt := range tests {
+		if cone.SubjectCovers(tt.pattern, tt.sub) != tt.expected {
+			t.Errorf("SubjectCovers(%q, %q) should be %t", tt.pattern, tt.sub, tt.expected)
+		}
+	}
+}
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.deleted", false},
+		{"orders.*.created", "orders.eu.>", true},
+		{"orders.*.created", "orders.eu.deleted", false},
+		{"orders.*", "orders.*.created", false},
+		{"orders.>", "orders", false},
+		{"*.created", "orders.*", true},
+		{">", "orders", true},
+	}
+
+	for _, tt := range tests {
+		if cone.SubjectsOverlap(tt.a, tt.b) != tt.expected {
+			t.Errorf("SubjectsOverlap(%q, %q) should be %t", tt.a, tt.b, tt.expected)
+		}
+		if cone.SubjectsOverlap(tt.b, tt.a) != tt.expected {
+			t.Errorf("SubjectsOverlap(%q, %q) should be %t", tt.b, tt.a, tt.expected)
+		}
+	}
+}
+
+func TestMostSpecificPattern(t *testing.T) {
+	patterns := []string{">", "orders.>", "orders.*", "orders.created", "*.created"}
+
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{"orders.created", "orders.created"},
+		{"orders.deleted", "orders.*"},
+		{"orders.created.v1", "orders.>"},
+		{"users.created", "*.created"},
+		{"users", ">"},
+	}
+
+	for _, tt := range tests {
+		pattern, ok := cone.MostSpecificPattern(tt.subject, patterns)
+		if !ok || pattern != tt.expected {
+			t.Fatalf("Expected %q for %q but got %q", tt.expected, tt.subject, pattern)
+		}
+	}
+
+	if _, ok := cone.MostSpecificPattern("orders.created", []string{"users.>"}); ok {
+		t.Fatalf("Expected no pattern to match")
+	}
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zapling/cone"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+const flagSampled = 0x01
+
+var (
+	ErrInvalidTraceParent = errors.New("invalid traceparent")
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span across services, as carried in the
+// traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+
+	// Remote is set on span contexts extracted from headers.
+	Remote bool
+}
+
+// IsValid reports whether sc has both a trace and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// IsSampled reports whether the trace is recorded.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// TraceParent formats sc as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+
+	var version, flags [1]byte
+	var sc SpanContext
+	if !decodeHex(version[:], parts[0]) ||
+		!decodeHex(sc.TraceID[:], parts[1]) ||
+		!decodeHex(sc.SpanID[:], parts[2]) ||
+		!decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+
+	// Later versions may append fields, version 00 has exactly four
+	if version[0] == 0xff || version[0] == 0 && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex s into dst, which it must fill exactly.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Extract returns the span context in the trace context headers of h.
+func Extract(h cone.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(h.Get(TraceParentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = h.Get(TraceStateHeader)
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject sets the trace context headers of h to sc. Invalid span contexts
+// are not injected.
+func Inject(h cone.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceParentHeader, sc.TraceParent())
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		delete(h, TraceStateHeader)
+	}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, or an
+// invalid one if there is none.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
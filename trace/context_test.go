@@ -0,0 +1,88 @@
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := trace.ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("Expected parsed IDs but got %s, %s", sc.TraceID, sc.SpanID)
+	}
+	if !sc.IsSampled() {
+		t.Fatalf("Expected sampled span context")
+	}
+	if sc.TraceParent() != traceParent {
+		t.Fatalf("Expected %q but got %q", traceParent, sc.TraceParent())
+	}
+
+	if _, err := trace.ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); err != nil {
+		t.Fatalf("Expected later version with extra fields to parse but got %v", err)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	}
+	for _, value := range invalid {
+		if _, err := trace.ParseTraceParent(value); !errors.Is(err, trace.ErrInvalidTraceParent) {
+			t.Fatalf("Expected ErrInvalidTraceParent for %q but got %v", value, err)
+		}
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	h := make(cone.Header)
+	h.Set(trace.TraceParentHeader, traceParent)
+	h.Set(trace.TraceStateHeader, "vendor=value")
+
+	sc, ok := trace.Extract(h)
+	if !ok || !sc.Remote || sc.TraceState != "vendor=value" {
+		t.Fatalf("Expected remote span context with trace state but got %+v", sc)
+	}
+
+	injected := make(cone.Header)
+	trace.Inject(injected, sc)
+	if injected.Get(trace.TraceParentHeader) != traceParent || injected.Get(trace.TraceStateHeader) != "vendor=value" {
+		t.Fatalf("Expected headers to be injected but got %v", injected)
+	}
+
+	if _, ok := trace.Extract(make(cone.Header)); ok {
+		t.Fatalf("Expected no span context without headers")
+	}
+
+	empty := make(cone.Header)
+	trace.Inject(empty, trace.SpanContext{})
+	if len(empty) != 0 {
+		t.Fatalf("Expected invalid span context not to be injected but got %v", empty)
+	}
+}
+
+func TestSpanContextFromContext(t *testing.T) {
+	if trace.SpanContextFromContext(context.Background()).IsValid() {
+		t.Fatalf("Expected invalid span context without one in the context")
+	}
+
+	sc, _ := trace.ParseTraceParent(traceParent)
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	if trace.SpanContextFromContext(ctx) != sc {
+		t.Fatalf("Expected span context from context")
+	}
+}
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"context"
+	"maps"
+
+	"github.com/zapling/cone"
+)
+
+// Span attributes set by Middleware and Publisher.
+const (
+	AttrSystem      = "messaging.system"
+	AttrDestination = "messaging.destination.name"
+	AttrOperation   = "messaging.operation"
+	AttrAttempt     = "messaging.delivery_attempt"
+	AttrOutcome     = "cone.outcome"
+	AttrError       = "error"
+)
+
+// Middleware returns middleware that continues the trace in the headers of
+// each event with a consumer span, carried by the event context. The span
+// records the subject, the delivery attempt and how the event was responded
+// to. Wrap the HandlerMux with it, rather than adding it with Use, so
+// responses made by the mux are recorded too.
+func Middleware(tracer Tracer) cone.Middleware {
+	return func(next cone.Handler) cone.Handler {
+		return cone.HandlerFunc(func(r cone.Response, e *cone.Event) {
+			ctx := e.Context()
+			if parent, ok := Extract(e.Header); ok {
+				ctx = ContextWithSpanContext(ctx, parent)
+			}
+
+			ctx, span := tracer.Start(ctx, e.Subject+" process", SpanKindConsumer)
+			defer span.End()
+
+			span.SetAttribute(AttrSystem, "nats")
+			span.SetAttribute(AttrDestination, e.Subject)
+			span.SetAttribute(AttrOperation, "process")
+			if attempt := cone.NumDelivered(r); attempt > 0 {
+				span.SetAttribute(AttrAttempt, attempt)
+			}
+
+			recorder := cone.RecordOutcome(r)
+			next.Serve(recorder, e.WithContext(ctx))
+
+			span.SetAttribute(AttrOutcome, string(recorder.Outcome()))
+		})
+	}
+}
+
+// Publisher returns publisher middleware that starts a producer span for
+// each event and injects it into the event headers.
+func Publisher(tracer Tracer) cone.PublisherMiddleware {
+	return func(next cone.Publisher) cone.Publisher {
+		return cone.PublisherFunc(func(ctx context.Context, e *cone.Event) error {
+			ctx, span := tracer.Start(ctx, e.Subject+" publish", SpanKindProducer)
+			defer span.End()
+
+			span.SetAttribute(AttrSystem, "nats")
+			span.SetAttribute(AttrDestination, e.Subject)
+			span.SetAttribute(AttrOperation, "publish")
+
+			traced := e.WithContext(e.Context())
+			traced.Header = maps.Clone(e.Header)
+			if traced.Header == nil {
+				traced.Header = make(cone.Header)
+			}
+			Inject(traced.Header, span.SpanContext())
+
+			err := next.Publish(ctx, traced)
+			if err != nil {
+				span.SetAttribute(AttrError, err.Error())
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package trace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+	"github.com/zapling/cone/trace"
+)
+
+type deliveryRecorder struct {
+	*conetest.ResponseRecorder
+	delivered uint64
+}
+
+func (r *deliveryRecorder) NumDelivered() uint64 {
+	return r.delivered
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Continues trace from headers", func(t *testing.T) {
+		exporter := &trace.InMemoryExporter{}
+		tracer := trace.NewTracer(exporter)
+
+		var handlerSpan trace.SpanContext
+		mux := cone.NewHandlerMux()
+		mux.HandleFunc("orders.created", func(_ cone.Response, e *cone.Event) {
+			handlerSpan = trace.SpanContextFromContext(e.Context())
+		})
+
+		e := conetest.NewEvent("orders.created", nil)
+		e.Header.Set(trace.TraceParentHeader, traceParent)
+
+		r := &deliveryRecorder{ResponseRecorder: conetest.NewRecorder(), delivered: 2}
+		trace.Middleware(tracer)(mux).Serve(r, e)
+
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("Expected 1 span but got %d", len(spans))
+		}
+		span := spans[0]
+		if span.Name != "orders.created process" || span.Kind != trace.SpanKindConsumer {
+			t.Fatalf("Expected consumer span but got %q", span.Name)
+		}
+		if span.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !span.Parent.Remote {
+			t.Fatalf("Expected span to continue the remote trace")
+		}
+		if handlerSpan != span.SpanContext {
+			t.Fatalf("Expected handler context to carry the span")
+		}
+
+		expected := map[string]any{
+			trace.AttrDestination: "orders.created",
+			trace.AttrAttempt:     uint64(2),
+			trace.AttrOutcome:     string(cone.OutcomeAck),
+		}
+		for key, value := range expected {
+			if span.Attributes[key] != value {
+				t.Fatalf("Expected attribute %s=%v but got %v", key, value, span.Attributes[key])
+			}
+		}
+	})
+
+	tests := []struct {
+		name     string
+		handler  cone.HandlerFunc
+		expected cone.Outcome
+	}{
+		{name: "Nak", handler: func(r cone.Response, _ *cone.Event) { _ = r.Nak() }, expected: cone.OutcomeNak},
+		{name: "Term", handler: func(r cone.Response, _ *cone.Event) { _ = cone.Term(r) }, expected: cone.OutcomeTerm},
+		{name: "No response", handler: func(cone.Response, *cone.Event) {}, expected: cone.OutcomeNone},
+		{
+			name: "First response counts",
+			handler: func(r cone.Response, _ *cone.Event) {
+				_ = r.Nak()
+				_ = r.Ack()
+			},
+			expected: cone.OutcomeNak,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exporter := &trace.InMemoryExporter{}
+			trace.Middleware(trace.NewTracer(exporter))(test.handler).Serve(conetest.NewRecorder(), conetest.NewEvent("orders.created", nil))
+
+			span := exporter.Spans()[0]
+			if span.Attributes[trace.AttrOutcome] != string(test.expected) {
+				t.Fatalf("Expected outcome %s but got %v", test.expected, span.Attributes[trace.AttrOutcome])
+			}
+			if span.Parent.IsValid() {
+				t.Fatalf("Expected a new trace without trace headers")
+			}
+		})
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	exporter := &trace.InMemoryExporter{}
+	tracer := trace.NewTracer(exporter)
+	p := conetest.NewPublisher()
+
+	ctx, parent := tracer.Start(context.Background(), "request", trace.SpanKindInternal)
+	publisher := trace.Publisher(tracer)(p)
+	if err := publisher.Publish(ctx, conetest.NewEvent("orders.created", nil)); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0].Name != "orders.created publish" || spans[0].Kind != trace.SpanKindProducer {
+		t.Fatalf("Expected producer span but got %+v", spans)
+	}
+
+	sc, ok := trace.Extract(p.Events()[0].Header)
+	if !ok || sc.SpanID != spans[0].SpanContext.SpanID {
+		t.Fatalf("Expected producer span to be injected into the headers")
+	}
+	if sc.TraceID != parent.SpanContext().TraceID {
+		t.Fatalf("Expected producer span to be part of the request trace")
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		exporter.Reset()
+
+		var consumed trace.SpanContext
+		handler := trace.Middleware(tracer)(cone.HandlerFunc(func(_ cone.Response, e *cone.Event) {
+			consumed = trace.SpanContextFromContext(e.Context())
+		}))
+		handler.Serve(conetest.NewRecorder(), p.Events()[0])
+
+		if consumed.TraceID != parent.SpanContext().TraceID {
+			t.Fatalf("Expected consumer span in the trace of the publisher")
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package trace
+
+import (
+	"context"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+// Tracer starts spans. It is kept small so it can be implemented on top of
+// an OpenTelemetry tracer, converting span contexts field by field.
+type Tracer interface {
+	// Start starts a span that is a child of the span context carried by
+	// ctx, if any. The returned context carries the new span context.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value any)
+	End()
+}
+
+// SpanData is a finished span, as passed to an Exporter.
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]any
+}
+
+// Exporter receives the sampled spans of a tracer created with NewTracer.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// NewTracer returns a Tracer passing finished spans to exporter. Spans
+// without a sampled parent start a new, sampled trace.
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{
+		TraceID:    parent.TraceID,
+		SpanID:     newSpanID(),
+		Flags:      parent.Flags,
+		TraceState: parent.TraceState,
+	}
+	if !parent.IsValid() {
+		sc.TraceID = newTraceID()
+		sc.Flags = flagSampled
+		sc.TraceState = ""
+	}
+
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  make(map[string]any),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), s
+}
+
+type span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+// End finishes the span. Only the first call has an effect.
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		for i := range id {
+			id[i] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		for i := range id {
+			id[i] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
+
+// InMemoryExporter keeps exported spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	span.Attributes = maps.Clone(span.Attributes)
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans, in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.spans)
+}
+
+// Reset forgets the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,52 @@
+package trace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zapling/cone/trace"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("Root and child spans", func(t *testing.T) {
+		exporter := &trace.InMemoryExporter{}
+		tracer := trace.NewTracer(exporter)
+
+		ctx, root := tracer.Start(context.Background(), "root", trace.SpanKindInternal)
+		_, child := tracer.Start(ctx, "child", trace.SpanKindInternal)
+		child.SetAttribute("key", "value")
+		child.End()
+		root.End()
+		root.End()
+
+		spans := exporter.Spans()
+		if len(spans) != 2 {
+			t.Fatalf("Expected 2 spans but got %d", len(spans))
+		}
+		if spans[0].Name != "child" || spans[0].Attributes["key"] != "value" {
+			t.Fatalf("Expected child span with attribute but got %+v", spans[0])
+		}
+		if spans[0].SpanContext.TraceID != spans[1].SpanContext.TraceID {
+			t.Fatalf("Expected child to share the trace of its parent")
+		}
+		if spans[0].Parent.SpanID != spans[1].SpanContext.SpanID {
+			t.Fatalf("Expected child to have root as parent")
+		}
+		if spans[1].Parent.IsValid() || !spans[1].SpanContext.IsSampled() {
+			t.Fatalf("Expected root to start a sampled trace")
+		}
+	})
+
+	t.Run("Unsampled parent", func(t *testing.T) {
+		exporter := &trace.InMemoryExporter{}
+		parent, _ := trace.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+		ctx := trace.ContextWithSpanContext(context.Background(), parent)
+		_, span := trace.NewTracer(exporter).Start(ctx, "span", trace.SpanKindInternal)
+		span.End()
+
+		if len(exporter.Spans()) != 0 {
+			t.Fatalf("Expected unsampled span not to be exported")
+		}
+	})
+}
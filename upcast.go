@@ -0,0 +1,234 @@
+package cone
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultSchemaVersionHeader = "schema-version"
+
+var (
+	ErrUnknownSchemaVersion = errors.New("unknown schema version")
+)
+
+// UpcastFunc transforms an event body from one schema version to the next.
+type UpcastFunc func(body []byte) ([]byte, error)
+
+// Upcaster transforms event bodies of older schema versions to the latest
+// version before they reach the handler. The version is read from a header
+// like "v2" or "2".
+//
+// Transformations are registered per subject, each one going from a version
+// to the next, and are chained to bring an event up to date.
+type Upcaster struct {
+	// Header holding the schema version. Defaults to "schema-version".
+	Header string
+
+	// DefaultVersion is the version of events without the header. If zero,
+	// such events are passed on untouched.
+	DefaultVersion int
+
+	// OnError responds to events that could not be upcast. If nil, they are
+	// Nak'd.
+	OnError func(r Response, e *Event, err error)
+
+	steps  map[string]map[int]UpcastFunc // subject pattern to from version
+	oldest map[string]int                // subject pattern to oldest supported version
+}
+
+func NewUpcaster() *Upcaster {
+	return &Upcaster{
+		steps:  make(map[string]map[int]UpcastFunc),
+		oldest: make(map[string]int),
+	}
+}
+
+// Register registers fn to transform bodies of events with a subject
+// matching pattern from fromVersion to fromVersion+1. It panics if a
+// transformation from that version is already registered.
+func (u *Upcaster) Register(pattern string, fromVersion int, fn UpcastFunc) {
+	if pattern == "" {
+		panic("empty subject is not allowed")
+	}
+	if fn == nil {
+		panic("upcast func is nil")
+	}
+
+	if u.steps == nil {
+		u.steps = make(map[string]map[int]UpcastFunc)
+	}
+
+	steps, ok := u.steps[pattern]
+	if !ok {
+		steps = make(map[int]UpcastFunc)
+		u.steps[pattern] = steps
+	}
+	if _, ok := steps[fromVersion]; ok {
+		panic(fmt.Sprintf("upcast of %s from version %d already registered", pattern, fromVersion))
+	}
+	steps[fromVersion] = fn
+}
+
+// SetOldestVersion declares the oldest schema version still supported for
+// subjects matching pattern. Versions start at 1 unless declared otherwise.
+// Events with an older version fail to upcast. It panics if version is less
+// than 1.
+func (u *Upcaster) SetOldestVersion(pattern string, version int) {
+	if pattern == "" {
+		panic("empty subject is not allowed")
+	}
+	if version < 1 {
+		panic(fmt.Sprintf("oldest version of %s must be at least 1, got %d", pattern, version))
+	}
+
+	if u.oldest == nil {
+		u.oldest = make(map[string]int)
+	}
+	u.oldest[pattern] = version
+}
+
+// OldestVersion returns the oldest schema version supported for subjects
+// matching pattern, 1 unless declared otherwise with SetOldestVersion.
+func (u *Upcaster) OldestVersion(pattern string) int {
+	if version, ok := u.oldest[pattern]; ok {
+		return version
+	}
+	return 1
+}
+
+// Latest returns the latest schema version for subjects matching pattern,
+// or zero if nothing is registered for it.
+func (u *Upcaster) Latest(pattern string) int {
+	steps, ok := u.steps[pattern]
+	if !ok {
+		return 0
+	}
+	return slices.Max(slices.Collect(maps.Keys(steps))) + 1
+}
+
+// Validate checks that every version from the oldest supported version, see
+// OldestVersion, to the latest version of each subject has a transformation
+// to the next version.
+func (u *Upcaster) Validate() error {
+	var errs []error
+	for _, pattern := range slices.Sorted(maps.Keys(u.steps)) {
+		for version := u.OldestVersion(pattern); version < u.Latest(pattern); version++ {
+			if _, ok := u.steps[pattern][version]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing upcast from version %d to %d", pattern, version, version+1))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Middleware upcasts events before passing them to next.
+func (u *Upcaster) Middleware(next Handler) Handler {
+	return HandlerFunc(func(r Response, e *Event) {
+		upcasted, err := u.Upcast(e)
+		if err != nil {
+			if u.OnError != nil {
+				u.OnError(r, e, err)
+				return
+			}
+			_ = r.Nak()
+			return
+		}
+		next.Serve(r, upcasted)
+	})
+}
+
+// Upcast returns a copy of e with its body transformed to the latest schema
+// version, and the version header updated. Events that are already up to
+// date, or have no transformations registered, are returned as is.
+func (u *Upcaster) Upcast(e *Event) (*Event, error) {
+	pattern, steps := u.stepsFor(e.Subject)
+	if steps == nil {
+		return e, nil
+	}
+
+	header := u.header()
+	value := e.Header.Get(header)
+	prefix, version := "", u.DefaultVersion
+	if value != "" {
+		var err error
+		prefix, version, err = parseSchemaVersion(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if version == 0 {
+		return e, nil
+	}
+
+	if oldest := u.OldestVersion(pattern); version < oldest {
+		return nil, fmt.Errorf("%w %d for %s, oldest supported is %d", ErrUnknownSchemaVersion, version, e.Subject, oldest)
+	}
+
+	latest := u.Latest(pattern)
+	if version > latest {
+		return nil, fmt.Errorf("%w %d for %s, latest is %d", ErrUnknownSchemaVersion, version, e.Subject, latest)
+	}
+	if version == latest {
+		return e, nil
+	}
+
+	body := e.Body
+	for ; version < latest; version++ {
+		step, ok := steps[version]
+		if !ok {
+			return nil, fmt.Errorf("%w %d for %s, no upcast registered", ErrUnknownSchemaVersion, version, e.Subject)
+		}
+
+		var err error
+		body, err = step(body)
+		if err != nil {
+			return nil, fmt.Errorf("upcast %s from version %d: %w", e.Subject, version, err)
+		}
+	}
+
+	upcasted := e.WithContext(e.Context())
+	upcasted.Body = body
+	upcasted.Header = maps.Clone(e.Header)
+	if upcasted.Header == nil {
+		upcasted.Header = make(Header)
+	}
+	upcasted.Header.Set(header, prefix+strconv.Itoa(latest))
+
+	return upcasted, nil
+}
+
+func (u *Upcaster) header() string {
+	if u.Header == "" {
+		return defaultSchemaVersionHeader
+	}
+	return u.Header
+}
+
+// stepsFor returns the transformations for the most specific pattern
+// matching subject.
+func (u *Upcaster) stepsFor(subject string) (string, map[int]UpcastFunc) {
+	pattern, ok := MostSpecificPattern(subject, slices.Collect(maps.Keys(u.steps)))
+	if !ok {
+		return "", nil
+	}
+	return pattern, u.steps[pattern]
+}
+
+// parseSchemaVersion parses versions like "v2" or "2", returning the prefix
+// used.
+func parseSchemaVersion(value string) (string, int, error) {
+	prefix := ""
+	if rest, ok := strings.CutPrefix(value, "v"); ok {
+		prefix, value = "v", rest
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("%w %q", ErrUnknownSchemaVersion, prefix+value)
+	}
+	return prefix, version, nil
+}
@@ -0,0 +1,240 @@
+package cone_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zapling/cone"
+	"github.com/zapling/cone/conetest"
+)
+
+func appendVersion(version string) cone.UpcastFunc {
+	return func(body []byte) ([]byte, error) {
+		return append(body, []byte(","+version)...), nil
+	}
+}
+
+func newOrderUpcaster() *cone.Upcaster {
+	u := cone.NewUpcaster()
+	u.Register("orders.created", 1, appendVersion("v2"))
+	u.Register("orders.created", 2, appendVersion("v3"))
+	return u
+}
+
+func versionedEvent(subject, body, version string) *cone.Event {
+	e := conetest.NewEvent(subject, []byte(body))
+	if version != "" {
+		e.Header.Set("schema-version", version)
+	}
+	return e
+}
+
+func TestUpcasterRegister(t *testing.T) {
+	t.Run("Duplicate version should panic", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatalf("Expected panic, upcast already registered")
+			}
+		}()
+
+		u := newOrderUpcaster()
+		u.Register("orders.created", 2, appendVersion("v3"))
+	})
+
+	t.Run("Zero value is usable", func(t *testing.T) {
+		var u cone.Upcaster
+		u.Register("orders.created", 1, appendVersion("v2"))
+		if latest := u.Latest("orders.created"); latest != 2 {
+			t.Fatalf("Expected latest version 2 but got %d", latest)
+		}
+	})
+}
+
+func TestUpcasterValidate(t *testing.T) {
+	t.Run("Complete chain", func(t *testing.T) {
+		if err := newOrderUpcaster().Validate(); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	})
+
+	t.Run("Version gap", func(t *testing.T) {
+		u := newOrderUpcaster()
+		u.Register("orders.created", 4, appendVersion("v5"))
+		u.Register("orders.deleted", 1, appendVersion("v2"))
+
+		err := u.Validate()
+		if err == nil {
+			t.Fatalf("Expected error for missing upcast from version 3")
+		}
+		if !strings.Contains(err.Error(), "orders.created: missing upcast from version 3 to 4") {
+			t.Fatalf("Expected error to name the gap but got %q", err)
+		}
+	})
+
+	t.Run("Missing first version", func(t *testing.T) {
+		u := cone.NewUpcaster()
+		u.Register("orders.created", 2, appendVersion("v3"))
+
+		err := u.Validate()
+		if err == nil || !strings.Contains(err.Error(), "orders.created: missing upcast from version 1 to 2") {
+			t.Fatalf("Expected error for missing upcast from version 1 but got %v", err)
+		}
+	})
+
+	t.Run("Declared oldest version", func(t *testing.T) {
+		u := cone.NewUpcaster()
+		u.SetOldestVersion("orders.created", 2)
+		u.Register("orders.created", 2, appendVersion("v3"))
+
+		if err := u.Validate(); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		_, err := u.Upcast(versionedEvent("orders.created", "v1", "v1"))
+		if !errors.Is(err, cone.ErrUnknownSchemaVersion) {
+			t.Fatalf("Expected ErrUnknownSchemaVersion for version older than supported but got %v", err)
+		}
+	})
+}
+
+func TestUpcast(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		body    string
+		header  string
+	}{
+		{name: "From first version", version: "v1", body: "v1,v2,v3", header: "v3"},
+		{name: "From middle version", version: "v2", body: "v2,v3", header: "v3"},
+		{name: "Latest version is untouched", version: "v3", body: "v3", header: "v3"},
+		{name: "Version without prefix", version: "1", body: "1,v2,v3", header: "3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := versionedEvent("orders.created", test.version, test.version)
+
+			upcasted, err := newOrderUpcaster().Upcast(e)
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if string(upcasted.Body) != test.body {
+				t.Fatalf("Expected body %q but got %q", test.body, upcasted.Body)
+			}
+			if version := upcasted.Header.Get("schema-version"); version != test.header {
+				t.Fatalf("Expected version header %q but got %q", test.header, version)
+			}
+			if e.Header.Get("schema-version") != test.version {
+				t.Fatalf("Expected original event to be unchanged")
+			}
+		})
+	}
+
+	t.Run("Newer version than latest", func(t *testing.T) {
+		_, err := newOrderUpcaster().Upcast(versionedEvent("orders.created", "", "v4"))
+		if !errors.Is(err, cone.ErrUnknownSchemaVersion) {
+			t.Fatalf("Expected ErrUnknownSchemaVersion but got %v", err)
+		}
+	})
+
+	t.Run("Invalid version", func(t *testing.T) {
+		_, err := newOrderUpcaster().Upcast(versionedEvent("orders.created", "", "latest"))
+		if !errors.Is(err, cone.ErrUnknownSchemaVersion) {
+			t.Fatalf("Expected ErrUnknownSchemaVersion but got %v", err)
+		}
+	})
+
+	t.Run("Missing header", func(t *testing.T) {
+		u := newOrderUpcaster()
+		e := versionedEvent("orders.created", "body", "")
+
+		upcasted, err := u.Upcast(e)
+		if err != nil || string(upcasted.Body) != "body" {
+			t.Fatalf("Expected event to be untouched but got %q, %v", upcasted.Body, err)
+		}
+
+		u.DefaultVersion = 1
+		upcasted, err = u.Upcast(e)
+		if err != nil || string(upcasted.Body) != "body,v2,v3" {
+			t.Fatalf("Expected event to be upcast from version 1 but got %q, %v", upcasted.Body, err)
+		}
+	})
+
+	t.Run("Failing upcast", func(t *testing.T) {
+		u := cone.NewUpcaster()
+		u.Register("orders.created", 1, func([]byte) ([]byte, error) {
+			return nil, errors.New("bad payload")
+		})
+
+		_, err := u.Upcast(versionedEvent("orders.created", "", "v1"))
+		if err == nil || !strings.Contains(err.Error(), "bad payload") {
+			t.Fatalf("Expected upcast error but got %v", err)
+		}
+	})
+
+	t.Run("Wildcard subject", func(t *testing.T) {
+		u := newOrderUpcaster()
+		u.Register("orders.*", 1, appendVersion("any"))
+
+		upcasted, err := u.Upcast(versionedEvent("orders.updated", "v1", "v1"))
+		if err != nil || string(upcasted.Body) != "v1,any" {
+			t.Fatalf("Expected wildcard upcast but got %q, %v", upcasted.Body, err)
+		}
+
+		upcasted, err = u.Upcast(versionedEvent("orders.created", "v1", "v1"))
+		if err != nil || string(upcasted.Body) != "v1,v2,v3" {
+			t.Fatalf("Expected exact subject to take precedence but got %q, %v", upcasted.Body, err)
+		}
+	})
+}
+
+func TestUpcasterMiddleware(t *testing.T) {
+	t.Run("Handler gets latest version", func(t *testing.T) {
+		var body string
+		mux := cone.NewHandlerMux()
+		mux.Use(newOrderUpcaster().Middleware)
+		mux.HandleFunc("orders.created", func(r cone.Response, e *cone.Event) {
+			body = string(e.Body)
+		})
+
+		r := conetest.NewRecorder()
+		mux.Serve(r, versionedEvent("orders.created", "v1", "v1"))
+		if body != "v1,v2,v3" {
+			t.Fatalf("Expected handler to get upcast body but got %q", body)
+		}
+		if r.Result() != conetest.Ack {
+			t.Fatalf("Expected Ack but got %s", r.Result())
+		}
+	})
+
+	t.Run("Unknown version is Nak'd", func(t *testing.T) {
+		called := false
+		handler := newOrderUpcaster().Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {
+			called = true
+		}))
+
+		r := conetest.NewRecorder()
+		handler.Serve(r, versionedEvent("orders.created", "", "v9"))
+		if called {
+			t.Fatalf("Expected handler not to be called")
+		}
+		if r.Result() != conetest.Nak {
+			t.Fatalf("Expected Nak but got %s", r.Result())
+		}
+	})
+
+	t.Run("OnError", func(t *testing.T) {
+		u := newOrderUpcaster()
+		u.OnError = func(r cone.Response, _ *cone.Event, _ error) {
+			_ = cone.Term(r)
+		}
+		handler := u.Middleware(cone.HandlerFunc(func(cone.Response, *cone.Event) {}))
+
+		r := conetest.NewRecorder()
+		handler.Serve(r, versionedEvent("orders.created", "", "v9"))
+		if r.Result() != conetest.Term {
+			t.Fatalf("Expected Term but got %s", r.Result())
+		}
+	})
+}